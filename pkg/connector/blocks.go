@@ -0,0 +1,227 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/GroveJay/matrix-groupme-bridge/pkg/groupmeclient"
+	"maunium.net/go/mautrix"
+	"maunium.net/go/mautrix/bridgev2"
+	"maunium.net/go/mautrix/bridgev2/matrix"
+	"maunium.net/go/mautrix/bridgev2/networkid"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+)
+
+// How often blocked users are synced with the Matrix ignore list
+const blockSyncInterval = 5 * time.Minute
+
+type GhostMetadata struct {
+	// Blocked is set when the user has been blocked from GroupMe or with the block command
+	Blocked bool `json:"blocked,omitempty"`
+}
+
+// loadBlocks replaces the cached set of blocked users with the list from GroupMe
+// and updates the ghosts of users who were blocked or unblocked since the last load
+func (groupmeClient *GroupmeClient) loadBlocks(ctx context.Context) error {
+	blocks, err := groupmeClient.Client.IndexBlock(ctx, groupmeClient.userId)
+	if err != nil {
+		return err
+	}
+	blockedUsers := make(map[groupmeclient.ID]bool, len(blocks))
+	for _, block := range blocks {
+		blockedUsers[block.BlockedUserID] = true
+	}
+	groupmeClient.blockedUsersLock.Lock()
+	previous := groupmeClient.blockedUsers
+	groupmeClient.blockedUsers = blockedUsers
+	groupmeClient.blockedUsersLock.Unlock()
+	for user := range blockedUsers {
+		groupmeClient.updateGhostBlocked(ctx, user, true)
+	}
+	for user := range previous {
+		if !blockedUsers[user] {
+			groupmeClient.updateGhostBlocked(ctx, user, false)
+		}
+	}
+	return nil
+}
+
+// syncBlocks refreshes the blocked users from GroupMe and reconciles them with the
+// m.ignored_user_list of the Matrix user, users blocked on one side since the last sync
+// are blocked on the other, the same goes for unblocking
+func (groupmeClient *GroupmeClient) syncBlocks(ctx context.Context) error {
+	if err := groupmeClient.loadBlocks(ctx); err != nil {
+		return err
+	}
+	intent := groupmeClient.doublePuppetIntent(ctx)
+	if intent == nil {
+		// The ignore list can only be read and written with double puppeting
+		return nil
+	}
+	var ignoreList event.IgnoredUserListEventContent
+	err := intent.Matrix.GetAccountData(ctx, event.AccountDataIgnoredUserList.Type, &ignoreList)
+	if err != nil && !errors.Is(err, mautrix.MNotFound) {
+		return err
+	}
+	if ignoreList.IgnoredUsers == nil {
+		ignoreList.IgnoredUsers = make(map[id.UserID]event.IgnoredUser)
+	}
+	ignored := make(map[groupmeclient.ID]id.UserID)
+	for mxid := range ignoreList.IgnoredUsers {
+		if userID, ok := groupmeClient.UserLogin.Bridge.Matrix.ParseGhostMXID(mxid); ok {
+			if _, isBot := ParseBotUserId(userID); !isBot {
+				ignored[groupmeclient.ID(userID)] = mxid
+			}
+		}
+	}
+
+	meta := groupmeClient.UserLogin.Metadata.(*UserLoginMetadata)
+	synced := make(map[groupmeclient.ID]bool, len(meta.SyncedBlocks))
+	for _, user := range meta.SyncedBlocks {
+		synced[user] = true
+	}
+	ignoreListChanged := false
+	for user, mxid := range ignored {
+		if groupmeClient.isBlocked(user) {
+			continue
+		} else if synced[user] {
+			// Unblocked on GroupMe
+			delete(ignoreList.IgnoredUsers, mxid)
+			ignoreListChanged = true
+		} else if err := groupmeClient.setBlocked(ctx, user, true); err != nil {
+			groupmeClient.UserLogin.Log.Err(err).Str("userId", user.String()).Msg("Failed to block user ignored on Matrix")
+		}
+	}
+	for _, user := range groupmeClient.blockedUserIDs() {
+		if _, ok := ignored[user]; ok {
+			continue
+		} else if synced[user] {
+			// Unignored on Matrix
+			if err := groupmeClient.setBlocked(ctx, user, false); err != nil {
+				groupmeClient.UserLogin.Log.Err(err).Str("userId", user.String()).Msg("Failed to unblock user unignored on Matrix")
+			}
+		} else {
+			ignoreList.IgnoredUsers[groupmeClient.UserLogin.Bridge.Matrix.GhostIntent(networkid.UserID(user)).GetMXID()] = event.IgnoredUser{}
+			ignoreListChanged = true
+		}
+	}
+	if ignoreListChanged {
+		if err := intent.Matrix.SetAccountData(ctx, event.AccountDataIgnoredUserList.Type, &ignoreList); err != nil {
+			return err
+		}
+	}
+
+	meta.SyncedBlocks = groupmeClient.blockedUserIDs()
+	return groupmeClient.UserLogin.Save(ctx)
+}
+
+// startBlockSync syncs the blocked users before the push connection can deliver DMs from them,
+// then keeps them in sync in the background until stopBlockSync
+func (groupmeClient *GroupmeClient) startBlockSync(ctx context.Context) {
+	if err := groupmeClient.syncBlocks(ctx); err != nil {
+		groupmeClient.UserLogin.Log.Warn().Msgf("GroupmeClient.startBlockSync: failed to sync blocked users: %s", err)
+	}
+	if groupmeClient.badCredentials.Load() {
+		return
+	}
+	syncCtx, cancel := context.WithCancel(groupmeClient.UserLogin.Log.WithContext(context.Background()))
+	groupmeClient.blockedUsersLock.Lock()
+	if groupmeClient.cancelBlockSync != nil {
+		groupmeClient.cancelBlockSync()
+	}
+	groupmeClient.cancelBlockSync = cancel
+	groupmeClient.blockedUsersLock.Unlock()
+	go groupmeClient.syncBlocksLoop(syncCtx)
+}
+
+func (groupmeClient *GroupmeClient) stopBlockSync() {
+	groupmeClient.blockedUsersLock.Lock()
+	defer groupmeClient.blockedUsersLock.Unlock()
+	if groupmeClient.cancelBlockSync != nil {
+		groupmeClient.cancelBlockSync()
+		groupmeClient.cancelBlockSync = nil
+	}
+}
+
+// syncBlocksLoop keeps the blocked users in sync until the context is cancelled, account data
+// isn't sent to appservices so changes to the ignore list are picked up by polling
+func (groupmeClient *GroupmeClient) syncBlocksLoop(ctx context.Context) {
+	ticker := time.NewTicker(blockSyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		if err := groupmeClient.syncBlocks(ctx); err != nil {
+			groupmeClient.UserLogin.Log.Warn().Msgf("GroupmeClient.syncBlocksLoop: failed to sync blocked users: %s", err)
+		}
+	}
+}
+
+// doublePuppetIntent returns the Matrix client of the user, or nil without double puppeting
+func (groupmeClient *GroupmeClient) doublePuppetIntent(ctx context.Context) *matrix.ASIntent {
+	intent, _ := groupmeClient.UserLogin.User.DoublePuppet(ctx).(*matrix.ASIntent)
+	return intent
+}
+
+func (groupmeClient *GroupmeClient) blockedUserIDs() []groupmeclient.ID {
+	groupmeClient.blockedUsersLock.Lock()
+	defer groupmeClient.blockedUsersLock.Unlock()
+	users := make([]groupmeclient.ID, 0, len(groupmeClient.blockedUsers))
+	for user := range groupmeClient.blockedUsers {
+		users = append(users, user)
+	}
+	return users
+}
+
+func (groupmeClient *GroupmeClient) isBlocked(user groupmeclient.ID) bool {
+	groupmeClient.blockedUsersLock.Lock()
+	defer groupmeClient.blockedUsersLock.Unlock()
+	return groupmeClient.blockedUsers[user]
+}
+
+// SetBlocked blocks or unblocks a user on GroupMe, then syncs the change to their ghost and the Matrix ignore list
+func (groupmeClient *GroupmeClient) SetBlocked(ctx context.Context, user groupmeclient.ID, blocked bool) error {
+	if err := groupmeClient.setBlocked(ctx, user, blocked); err != nil {
+		return err
+	}
+	return groupmeClient.syncBlocks(ctx)
+}
+
+// setBlocked blocks or unblocks a user on GroupMe and refreshes the cached blocked users
+func (groupmeClient *GroupmeClient) setBlocked(ctx context.Context, user groupmeclient.ID, blocked bool) error {
+	var err error
+	if blocked {
+		_, err = groupmeClient.Client.CreateBlock(ctx, groupmeClient.userId, user)
+	} else {
+		err = groupmeClient.Client.Unblock(ctx, groupmeClient.userId, user)
+	}
+	if err != nil {
+		return err
+	}
+	return groupmeClient.loadBlocks(ctx)
+}
+
+func (groupmeClient *GroupmeClient) updateGhostBlocked(ctx context.Context, user groupmeclient.ID, blocked bool) {
+	ghost, err := groupmeClient.UserLogin.Bridge.GetGhostByID(ctx, networkid.UserID(user))
+	if err != nil {
+		groupmeClient.UserLogin.Log.Err(err).Str("userId", user.String()).Msg("Failed to get ghost to update blocked status")
+		return
+	}
+	ghost.UpdateInfo(ctx, &bridgev2.UserInfo{ExtraUpdates: updateGhostBlocked(blocked)})
+}
+
+func updateGhostBlocked(blocked bool) bridgev2.ExtraUpdater[*bridgev2.Ghost] {
+	return func(ctx context.Context, ghost *bridgev2.Ghost) bool {
+		meta := ghost.Metadata.(*GhostMetadata)
+		if meta.Blocked == blocked {
+			return false
+		}
+		meta.Blocked = blocked
+		return true
+	}
+}
@@ -3,7 +3,11 @@ package connector
 import (
 	"context"
 	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/GroveJay/matrix-groupme-bridge/pkg/faye"
 	"github.com/GroveJay/matrix-groupme-bridge/pkg/groupmeclient"
 	"github.com/GroveJay/matrix-groupme-bridge/pkg/groupmerealtime"
 	"maunium.net/go/mautrix/bridgev2"
@@ -13,12 +17,29 @@ import (
 	"maunium.net/go/mautrix/event"
 )
 
+// How long Disconnect waits for the push server and the push goroutines
+const disconnectTimeout = 10 * time.Second
+
 type GroupmeClient struct {
+	Connector        *GroupmeConnector
 	UserLogin        *bridgev2.UserLogin
 	PushSubscription *groupmerealtime.PushSubscription
 	Client           *groupmeclient.Client
 	AuthToken        string
 	userId           groupmeclient.ID
+
+	// groupID -> userID -> member, used to resolve membership IDs
+	groupMembers map[groupmeclient.ID]map[groupmeclient.ID]*groupmeclient.Member
+	// groupID -> userID of the creator, who keeps the owner power level whatever their roles
+	groupCreators    map[groupmeclient.ID]groupmeclient.ID
+	groupMembersLock sync.Mutex
+
+	blockedUsers     map[groupmeclient.ID]bool
+	blockedUsersLock sync.Mutex
+	cancelBlockSync  context.CancelFunc
+
+	// Set once GroupMe rejects the auth token, until the user logs in again
+	badCredentials atomic.Bool
 }
 
 var _ bridgev2.NetworkAPI = (*GroupmeClient)(nil)
@@ -35,13 +56,18 @@ func (groupmeClient *GroupmeClient) Connect(ctx context.Context) {
 		return
 	}
 
-	groupmeClient.Client = groupmeclient.NewClient(groupmeClient.AuthToken)
+	groupmeClient.badCredentials.Store(false)
+	groupmeClient.Client = groupmeClient.Connector.newClient(groupmeClient.AuthToken)
+	groupmeClient.Client.OnUnauthorized(groupmeClient.handleBadCredentials)
 	groupmeClient.UserLogin.Log.Info().Msg("GroupmeClient.Connect: NewClient created")
 
 	if user, err := groupmeClient.Client.MyUser(ctx); err != nil {
 		groupmeClient.UserLogin.Log.Error().Msg("Getting user information failed!")
+		if groupmeClient.badCredentials.Load() {
+			return
+		}
 		groupmeClient.UserLogin.BridgeState.Send(status.BridgeState{
-			StateEvent: status.StateBadCredentials,
+			StateEvent: status.StateUnknownError,
 			Error:      "groupme-get-user",
 			Message:    "Failed to get user information",
 			Info: map[string]any{
@@ -51,16 +77,21 @@ func (groupmeClient *GroupmeClient) Connect(ctx context.Context) {
 		return
 	} else {
 		groupmeClient.userId = user.ID
+		groupmeClient.updateRemoteProfile(ctx, user)
 	}
 
 	groupmeClient.UserLogin.Log.Info().Msg("GroupmeClient.Connect: got UserId")
+	groupmeClient.startBlockSync(ctx)
 	groupmeClient.PushSubscription.AddFullHandler(groupmeClient)
 	groupmeClient.UserLogin.Log.Info().Msg("GroupmeClient.Connect: added handler")
 	fayeZeroLogger := &groupmerealtime.FayeZeroLogger{Logger: groupmeClient.UserLogin.Log}
-	if err := groupmeClient.PushSubscription.Setup(context.Background(), *groupmerealtime.NewFayeClient(*fayeZeroLogger, groupmeClient.AuthToken)); err != nil {
+	if err := groupmeClient.PushSubscription.Setup(context.Background(), groupmeClient.Connector.newFayeClient(*fayeZeroLogger, groupmeClient.AuthToken)); err != nil {
 		groupmeClient.UserLogin.Log.Error().Msg("Setting up PushSubscription failed!")
+		if groupmeClient.badCredentials.Load() {
+			return
+		}
 		groupmeClient.UserLogin.BridgeState.Send(status.BridgeState{
-			StateEvent: status.StateBadCredentials,
+			StateEvent: status.StateUnknownError,
 			Error:      "groupme-setup-pushsubscription",
 			Message:    "Failed to setup PushSubscription",
 			Info: map[string]any{
@@ -73,8 +104,11 @@ func (groupmeClient *GroupmeClient) Connect(ctx context.Context) {
 
 	if err := groupmeClient.PushSubscription.SubscribeToUser(ctx, groupmeClient.userId); err != nil {
 		groupmeClient.UserLogin.Log.Error().Msg("Subscription failed!")
+		if groupmeClient.badCredentials.Load() {
+			return
+		}
 		groupmeClient.UserLogin.BridgeState.Send(status.BridgeState{
-			StateEvent: status.StateBadCredentials,
+			StateEvent: status.StateUnknownError,
 			Error:      "groupme-subscribe-to-user",
 			Message:    "Failed to subscribe to user",
 			Info: map[string]any{
@@ -93,14 +127,101 @@ func (groupmeClient *GroupmeClient) Connect(ctx context.Context) {
 	// The alternative is to occasionally poll over all chats and update all messages, Members, etc
 }
 
+// updateRemoteProfile keeps the name and avatar of the login in sync with the GroupMe account,
+// the avatar is bridged through the ghost of the user
+func (groupmeClient *GroupmeClient) updateRemoteProfile(ctx context.Context, user *groupmeclient.User) {
+	profile := remoteProfile(user)
+	ghost, err := groupmeClient.UserLogin.Bridge.GetGhostByID(ctx, networkid.UserID(user.ID))
+	if err != nil {
+		groupmeClient.UserLogin.Log.Warn().Msgf("GroupmeClient.updateRemoteProfile: failed to get own ghost: %s", err)
+	} else {
+		ghost.UpdateInfo(ctx, &bridgev2.UserInfo{
+			Name:   &user.Name,
+			Avatar: wrapAvatar(user.ImageURL),
+		})
+		profile.Avatar = ghost.AvatarMXC
+	}
+	if groupmeClient.UserLogin.RemoteName == user.Name && groupmeClient.UserLogin.RemoteProfile == profile {
+		return
+	}
+	groupmeClient.UserLogin.RemoteName = user.Name
+	groupmeClient.UserLogin.RemoteProfile = profile
+	if err := groupmeClient.UserLogin.Save(ctx); err != nil {
+		groupmeClient.UserLogin.Log.Warn().Msgf("GroupmeClient.updateRemoteProfile: failed to save login: %s", err)
+	}
+}
+
 func (groupmeClient *GroupmeClient) Disconnect() {
 	groupmeClient.UserLogin.Log.Info().Msg("GroupmeClient.Disconnect")
-	groupmeClient.Client.Close()
+	groupmeClient.stopBlockSync()
+	if groupmeClient.PushSubscription != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), disconnectTimeout)
+		defer cancel()
+		if err := groupmeClient.PushSubscription.Close(ctx); err != nil {
+			groupmeClient.UserLogin.Log.Warn().Msgf("GroupmeClient.Disconnect: failed to close the push subscription: %s", err)
+		}
+	}
+	if groupmeClient.Client != nil {
+		groupmeClient.Client.Close()
+	}
 }
 
+// IsLoggedIn reflects the real connection state, GroupMe has to accept the token and the push connection has to be up
 func (groupmeClient *GroupmeClient) IsLoggedIn() bool {
-	groupmeClient.UserLogin.Log.Info().Msg("GroupmeClient.IsLoggedIn")
-	return true // groupmeClient.PushSubscription.Connected()?
+	return !groupmeClient.badCredentials.Load() && groupmeClient.PushSubscription.Connected()
+}
+
+// HandleConnectionEvent reports the state of the push server connection as the bridge state of the login
+func (groupmeClient *GroupmeClient) HandleConnectionEvent(connectionEvent faye.ConnectionEvent, err error) {
+	groupmeClient.UserLogin.Log.Debug().Msgf("HandleConnectionEvent (event: %s, error: %v)", connectionEvent, err)
+	if groupmeClient.badCredentials.Load() {
+		return
+	}
+	state := status.BridgeState{Info: map[string]any{}}
+	switch connectionEvent {
+	case faye.EventConnecting:
+		state.StateEvent = status.StateConnecting
+	case faye.EventConnected:
+		state.StateEvent = status.StateConnected
+	case faye.EventTransientDisconnect:
+		state.StateEvent = status.StateTransientDisconnect
+		state.Error = "groupme-push-disconnected"
+		state.Message = "Lost connection to the GroupMe push server, reconnecting"
+	case faye.EventDisconnected:
+		state.StateEvent = status.StateUnknownError
+		state.Error = "groupme-push-server-none"
+		state.Message = "The GroupMe push server asked the bridge not to reconnect"
+	default:
+		return
+	}
+	if err != nil {
+		state.Info["go_error"] = err.Error()
+	}
+	groupmeClient.UserLogin.BridgeState.Send(state)
+}
+
+// HandleReconnectAttempt logs the retries to reach the push server, the bridge state is already set by HandleConnectionEvent
+func (groupmeClient *GroupmeClient) HandleReconnectAttempt(retry int, delay time.Duration, err error) {
+	groupmeClient.UserLogin.Log.Warn().Msgf("GroupmeClient.HandleReconnectAttempt: retry %d after %s (error: %v)", retry, delay, err)
+}
+
+// handleBadCredentials is called when GroupMe rejects the auth token, either from an API call or the push server.
+// The push loops are stopped and the user is asked to log in again, which replaces the token of this login.
+func (groupmeClient *GroupmeClient) handleBadCredentials(err error) {
+	if groupmeClient.badCredentials.Swap(true) {
+		return
+	}
+	groupmeClient.UserLogin.Log.Warn().Msgf("GroupmeClient.handleBadCredentials: %s", err)
+	groupmeClient.PushSubscription.Stop()
+	groupmeClient.stopBlockSync()
+	groupmeClient.UserLogin.BridgeState.Send(status.BridgeState{
+		StateEvent: status.StateBadCredentials,
+		Error:      "groupme-unauthorized",
+		Message:    "GroupMe rejected the auth token, please log in again",
+		Info: map[string]any{
+			"go_error": err.Error(),
+		},
+	})
 }
 
 func (groupmeClient *GroupmeClient) LogoutRemote(ctx context.Context) {
@@ -125,38 +246,65 @@ func (groupmeClient *GroupmeClient) GetChatInfo(ctx context.Context, portal *bri
 	if err != nil {
 		return nil, err
 	}
+	if otherUser, isDM := directMessageOtherUser(*groupID, groupmeClient.userId); isDM {
+		return groupmeClient.directMessageChatInfo(otherUser), nil
+	}
 	group, err := groupmeClient.Client.ShowGroup(ctx, *groupID)
 	if err != nil {
 		groupmeClient.UserLogin.Log.Error().Msgf("GroupmeClient.GetChatInfo: Failed to get group information for groupID %s", groupID)
 		return nil, err
 	}
+	groupmeClient.cacheGroupMembers(group)
 	members := &bridgev2.ChatMemberList{
-		IsFull:    true,
-		MemberMap: make(map[networkid.UserID]bridgev2.ChatMember, len(group.Members)),
+		IsFull:      true,
+		MemberMap:   make(map[networkid.UserID]bridgev2.ChatMember, len(group.Members)),
+		PowerLevels: groupPowerLevels(),
 	}
 	for _, member := range group.Members {
-		membership := event.MembershipJoin
-		if member.AutoKicked {
-			membership = event.MembershipBan
-		}
-		members.MemberMap[networkid.UserID(member.UserID)] = bridgev2.ChatMember{
-			Nickname:   &member.Nickname,
-			Membership: membership,
-			UserInfo: &bridgev2.UserInfo{
-				Avatar: wrapAvatar(member.ImageURL),
-			},
-		}
+		chatMember := groupmeClient.chatMember(member)
+		chatMember.PowerLevel = memberPowerLevel(member, member.UserID == group.CreatorUserID)
+		members.MemberMap[networkid.UserID(member.UserID)] = chatMember
 	}
-	return &bridgev2.ChatInfo{
+	chatInfo := &bridgev2.ChatInfo{
 		Name:    &group.Name,
 		Topic:   &group.Description,
 		Avatar:  wrapAvatar(group.ImageURL),
 		Members: members,
-	}, nil
+	}
+	if self := group.GetMemberByUserID(groupmeClient.userId); self != nil {
+		chatInfo.UserLocal = userLocalInfo(self.Muted)
+	}
+	return chatInfo, nil
+}
+
+// directMessageChatInfo describes a direct message conversation, which only consists of its two members
+func (groupmeClient *GroupmeClient) directMessageChatInfo(otherUser groupmeclient.ID) *bridgev2.ChatInfo {
+	roomType := database.RoomTypeDM
+	return &bridgev2.ChatInfo{
+		Type: &roomType,
+		Members: &bridgev2.ChatMemberList{
+			IsFull:      true,
+			OtherUserID: networkid.UserID(otherUser),
+			MemberMap: map[networkid.UserID]bridgev2.ChatMember{
+				networkid.UserID(groupmeClient.userId): {
+					EventSender: groupmeClient.eventSender(groupmeClient.userId),
+					Membership:  event.MembershipJoin,
+				},
+				networkid.UserID(otherUser): {
+					EventSender: groupmeClient.eventSender(otherUser),
+					Membership:  event.MembershipJoin,
+				},
+			},
+		},
+	}
 }
 
 func (groupmeClient *GroupmeClient) GetUserInfo(ctx context.Context, ghost *bridgev2.Ghost) (*bridgev2.UserInfo, error) {
 	groupmeClient.UserLogin.Log.Info().Msgf("GroupmeClient.GetUserInfo: ghostID %s", ghost.ID)
+	if _, isBot := ParseBotUserId(ghost.ID); isBot {
+		// Bot ghosts are updated from the name and avatar of the messages they send
+		return nil, nil
+	}
 	relations, err := groupmeClient.Client.IndexAllRelations(ctx)
 	if err != nil {
 		return nil, err
@@ -178,8 +326,9 @@ func (groupmeClient *GroupmeClient) GetUserInfo(ctx context.Context, ghost *brid
 			matchingRelation.PhoneNumber.String(),
 			matchingRelation.Email,
 		},
-		Name:   &matchingRelation.Name,
-		Avatar: wrapAvatar(matchingRelation.AvatarURL),
+		Name:         &matchingRelation.Name,
+		Avatar:       wrapAvatar(matchingRelation.AvatarURL),
+		ExtraUpdates: updateGhostBlocked(matchingRelation.Blocked),
 	}, nil
 }
 
@@ -188,13 +337,20 @@ func (g *GroupmeClient) HandleMatrixMessage(ctx context.Context, msg *bridgev2.M
 	if err != nil {
 		return nil, err
 	}
-	groupmemessage, err := g.Client.CreateMessage(ctx, *groupmeclientID, &groupmeclient.Message{
+	outgoing := &groupmeclient.Message{
 		Text: msg.Content.Body,
 		// TODO: Add attachments, emojis, etc
 		// GetCapabilities() will need updating after so messages don't get rejected
-	})
+	}
+	var groupmemessage *groupmeclient.Message
+	if otherUser, isDM := directMessageOtherUser(*groupmeclientID, g.userId); isDM {
+		outgoing.RecipientID = otherUser
+		groupmemessage, err = g.Client.CreateDirectMessage(ctx, outgoing)
+	} else {
+		groupmemessage, err = g.Client.CreateMessage(ctx, *groupmeclientID, outgoing)
+	}
 	if err != nil {
-		return nil, err
+		return nil, wrapGroupmeError(err)
 	}
 	return &bridgev2.MatrixMessageResponse{
 		DB: &database.Message{
@@ -0,0 +1,470 @@
+package connector
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/GroveJay/matrix-groupme-bridge/pkg/groupmeclient"
+	"maunium.net/go/mautrix/bridgev2/commands"
+)
+
+var HelpSectionGroupme = commands.HelpSection{Name: "GroupMe", Order: 30}
+
+// How many groups or chats the list commands fetch per request
+const listPageSize = 100
+
+// groupmeCommands are the GroupMe specific bridge bot commands, registered in Init
+var groupmeCommands = []commands.CommandHandler{
+	cmdBlock,
+	cmdUnblock,
+	cmdFormerGroups,
+	cmdRejoin,
+	cmdJoin,
+	cmdListGroups,
+	cmdListDMs,
+	cmdSync,
+	cmdShareLink,
+	cmdTransferOwner,
+	cmdDestroyGroup,
+	cmdWhoami,
+}
+
+var cmdBlock = &commands.FullHandler{
+	Func: fnSetBlocked(true),
+	Name: "block",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionGroupme,
+		Description: "Block a GroupMe user, so they can no longer send you direct messages",
+		Args:        "<_user ID_>",
+	},
+	RequiresLogin: true,
+}
+
+var cmdUnblock = &commands.FullHandler{
+	Func: fnSetBlocked(false),
+	Name: "unblock",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionGroupme,
+		Description: "Unblock a GroupMe user",
+		Args:        "<_user ID_>",
+	},
+	RequiresLogin: true,
+}
+
+var cmdFormerGroups = &commands.FullHandler{
+	Func: fnFormerGroups,
+	Name: "former-groups",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionGroupme,
+		Description: "List the GroupMe groups you have left but can rejoin",
+	},
+	RequiresLogin: true,
+}
+
+var cmdRejoin = &commands.FullHandler{
+	Func: fnRejoin,
+	Name: "rejoin",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionGroupme,
+		Description: "Rejoin a GroupMe group you have left and recreate its portal",
+		Args:        "<_group ID_>",
+	},
+	RequiresLogin: true,
+}
+
+var cmdJoin = &commands.FullHandler{
+	Func: fnJoin,
+	Name: "join",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionGroupme,
+		Description: "Join a GroupMe group with a share link",
+		Args:        "<_share link_>",
+	},
+	RequiresLogin: true,
+}
+
+var cmdListGroups = &commands.FullHandler{
+	Func: fnListGroups,
+	Name: "list-groups",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionGroupme,
+		Description: "List the GroupMe groups you're in",
+	},
+	RequiresLogin: true,
+}
+
+var cmdListDMs = &commands.FullHandler{
+	Func: fnListDMs,
+	Name: "list-dms",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionGroupme,
+		Description: "List your GroupMe direct message conversations",
+	},
+	RequiresLogin: true,
+}
+
+var cmdSync = &commands.FullHandler{
+	Func: fnSync,
+	Name: "sync",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionGroupme,
+		Description: "Sync the info and members of a GroupMe group, creating its portal if needed",
+		Args:        "<_group ID_>",
+	},
+	RequiresLogin: true,
+}
+
+var cmdShareLink = &commands.FullHandler{
+	Func: fnShareLink,
+	Name: "share-link",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionGroupme,
+		Description: "Turn the share link of the current group on or off",
+		Args:        "<on|off>",
+	},
+	RequiresLogin:  true,
+	RequiresPortal: true,
+}
+
+var cmdTransferOwner = &commands.FullHandler{
+	Func: fnTransferOwner,
+	Name: "transfer-owner",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionGroupme,
+		Description: "Make another member the owner of the current group",
+		Args:        "<_user ID_>",
+	},
+	RequiresLogin:  true,
+	RequiresPortal: true,
+}
+
+var cmdDestroyGroup = &commands.FullHandler{
+	Func: fnDestroyGroup,
+	Name: "destroy-group",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionGroupme,
+		Description: "Delete the current group on GroupMe for everyone",
+	},
+	RequiresLogin:  true,
+	RequiresPortal: true,
+}
+
+var cmdWhoami = &commands.FullHandler{
+	Func: fnWhoami,
+	Name: "whoami",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionGroupme,
+		Description: "Show the GroupMe account you're logged in as",
+	},
+	RequiresLogin: true,
+}
+
+// getClient returns the GroupMe client of the user's default login
+func getClient(ce *commands.Event) *GroupmeClient {
+	login := ce.User.GetDefaultLogin()
+	if login == nil {
+		ce.Reply("You're not logged in")
+		return nil
+	}
+	client, ok := login.Client.(*GroupmeClient)
+	if !ok || client.Client == nil {
+		ce.Reply("Your GroupMe login isn't connected")
+		return nil
+	}
+	return client
+}
+
+// getPortalGroup returns the GroupMe client and group of the portal the command was sent in
+func getPortalGroup(ce *commands.Event) (*GroupmeClient, groupmeclient.ID) {
+	groupID, loginID, err := ParsePortalId(ce.Portal.ID)
+	if err != nil {
+		ce.Reply("This room isn't a GroupMe portal")
+		return nil, ""
+	}
+	if _, isDM := directMessageOtherUser(*groupID, ""); isDM {
+		ce.Reply("This command only works in group portals")
+		return nil, ""
+	}
+	login, err := ce.Bridge.GetExistingUserLoginByID(ce.Ctx, *loginID)
+	if err != nil || login == nil || login.UserMXID != ce.User.MXID {
+		ce.Reply("This portal doesn't belong to one of your logins")
+		return nil, ""
+	}
+	client, ok := login.Client.(*GroupmeClient)
+	if !ok || client.Client == nil {
+		ce.Reply("Your GroupMe login isn't connected")
+		return nil, ""
+	}
+	return client, *groupID
+}
+
+func fnSetBlocked(blocked bool) func(*commands.Event) {
+	return func(ce *commands.Event) {
+		if len(ce.Args) != 1 {
+			ce.Reply("**Usage:** `$cmdprefix %s <user ID>`", ce.Command)
+			return
+		}
+		client := getClient(ce)
+		if client == nil {
+			return
+		}
+		user := groupmeclient.ID(ce.Args[0])
+		if !user.Valid() {
+			ce.Reply("`%s` is not a valid GroupMe user ID", ce.Args[0])
+			return
+		}
+		if err := client.SetBlocked(ce.Ctx, user, blocked); err != nil {
+			ce.Reply("Failed to %s user: %v", ce.Command, err)
+			return
+		}
+		ce.Reply("Successfully %sed user `%s`", ce.Command, user)
+	}
+}
+
+func fnFormerGroups(ce *commands.Event) {
+	client := getClient(ce)
+	if client == nil {
+		return
+	}
+	groups, err := client.Client.FormerGroups(ce.Ctx)
+	if err != nil {
+		ce.Reply("Failed to get former groups: %v", err)
+		return
+	}
+	if len(groups) == 0 {
+		ce.Reply("You haven't left any groups that can be rejoined")
+		return
+	}
+	lines := make([]string, len(groups))
+	for i, group := range groups {
+		lines[i] = fmt.Sprintf("* %s (`%s`)", group.Name, group.ID)
+	}
+	ce.Reply("Groups you can rejoin with `$cmdprefix rejoin <group ID>`:\n\n%s", strings.Join(lines, "\n"))
+}
+
+func fnRejoin(ce *commands.Event) {
+	if len(ce.Args) != 1 {
+		ce.Reply("**Usage:** `$cmdprefix rejoin <group ID>`")
+		return
+	}
+	client := getClient(ce)
+	if client == nil {
+		return
+	}
+	group := groupmeclient.ID(ce.Args[0])
+	if !group.Valid() {
+		ce.Reply("`%s` is not a valid GroupMe group ID", ce.Args[0])
+		return
+	}
+	rejoined, err := client.rejoinGroup(ce.Ctx, group)
+	if err != nil {
+		ce.Reply("Failed to rejoin group: %v", err)
+		return
+	}
+	ce.Reply("Rejoined **%s**, its portal is being recreated", rejoined.Name)
+}
+
+func fnJoin(ce *commands.Event) {
+	if len(ce.Args) != 1 {
+		ce.Reply("**Usage:** `$cmdprefix join <share link>`")
+		return
+	}
+	client := getClient(ce)
+	if client == nil {
+		return
+	}
+	group, portal, err := client.joinGroupByShareURL(ce.Ctx, ce.Args[0])
+	if err != nil {
+		ce.Reply("Failed to join group: %v", err)
+		return
+	}
+	if portal == nil || portal.MXID == "" {
+		ce.Reply("Joined **%s**", group.Name)
+		return
+	}
+	ce.Reply("Joined **%s**, its portal is [%s](%s)", group.Name, portal.MXID, portal.MXID.URI().MatrixToURL())
+}
+
+func fnListGroups(ce *commands.Event) {
+	client := getClient(ce)
+	if client == nil {
+		return
+	}
+	var lines []string
+	for page := 1; ; page++ {
+		groups, err := client.Client.IndexGroups(ce.Ctx, &groupmeclient.GroupsQuery{
+			Page:    page,
+			PerPage: listPageSize,
+			Omit:    "memberships",
+		})
+		if err != nil {
+			ce.Reply("Failed to get groups: %v", err)
+			return
+		}
+		for _, group := range groups {
+			lines = append(lines, fmt.Sprintf("* %s (`%s`)", group.Name, group.ID))
+		}
+		if len(groups) < listPageSize {
+			break
+		}
+	}
+	if len(lines) == 0 {
+		ce.Reply("You're not in any groups")
+		return
+	}
+	ce.Reply("%s", strings.Join(lines, "\n"))
+}
+
+func fnListDMs(ce *commands.Event) {
+	client := getClient(ce)
+	if client == nil {
+		return
+	}
+	var lines []string
+	for page := 1; ; page++ {
+		chats, err := client.Client.IndexChats(ce.Ctx, &groupmeclient.IndexChatsQuery{
+			Page:    page,
+			PerPage: listPageSize,
+		})
+		if err != nil {
+			ce.Reply("Failed to get direct messages: %v", err)
+			return
+		}
+		for _, chat := range chats {
+			lines = append(lines, fmt.Sprintf("* %s (`%s`)", chat.OtherUser.Name, chat.OtherUser.ID))
+		}
+		if len(chats) < listPageSize {
+			break
+		}
+	}
+	if len(lines) == 0 {
+		ce.Reply("You don't have any direct messages")
+		return
+	}
+	ce.Reply("%s", strings.Join(lines, "\n"))
+}
+
+func fnSync(ce *commands.Event) {
+	if len(ce.Args) != 1 {
+		ce.Reply("**Usage:** `$cmdprefix sync <group ID>`")
+		return
+	}
+	client := getClient(ce)
+	if client == nil {
+		return
+	}
+	group := groupmeclient.ID(ce.Args[0])
+	if !group.Valid() {
+		ce.Reply("`%s` is not a valid GroupMe group ID", ce.Args[0])
+		return
+	}
+	portal, err := client.openPortal(ce.Ctx, group)
+	if err != nil {
+		ce.Reply("Failed to sync group: %v", err)
+		return
+	}
+	ce.Reply("Synced [%s](%s)", portal.MXID, portal.MXID.URI().MatrixToURL())
+}
+
+func fnShareLink(ce *commands.Event) {
+	if len(ce.Args) != 1 || (ce.Args[0] != "on" && ce.Args[0] != "off") {
+		ce.Reply("**Usage:** `$cmdprefix share-link <on|off>`")
+		return
+	}
+	client, _ := getPortalGroup(ce)
+	if client == nil {
+		return
+	}
+	share := ce.Args[0] == "on"
+	group, err := client.updateGroupSettings(ce.Ctx, ce.Portal, func(settings *groupmeclient.GroupSettings) {
+		settings.Share = share
+	})
+	if err != nil {
+		ce.Reply("Failed to update share link: %v", err)
+		return
+	}
+	if !share {
+		ce.Reply("Turned off the share link")
+	} else if group.ShareURL == "" {
+		ce.Reply("Turned on the share link, but GroupMe didn't return it")
+	} else {
+		ce.Reply("Share link: %s", group.ShareURL)
+	}
+}
+
+func fnTransferOwner(ce *commands.Event) {
+	if len(ce.Args) != 1 {
+		ce.Reply("**Usage:** `$cmdprefix transfer-owner <user ID>`")
+		return
+	}
+	client, group := getPortalGroup(ce)
+	if client == nil {
+		return
+	}
+	owner := groupmeclient.ID(ce.Args[0])
+	if !owner.Valid() {
+		ce.Reply("`%s` is not a valid GroupMe user ID", ce.Args[0])
+		return
+	}
+	result, err := client.Client.ChangeGroupOwner(ce.Ctx, groupmeclient.ChangeOwnerRequest{
+		GroupID: group.String(),
+		OwnerID: owner.String(),
+	})
+	if err != nil {
+		ce.Reply("Failed to transfer ownership: %v", err)
+		return
+	}
+	if result.Status != groupmeclient.ChangeOwnerOk {
+		ce.Reply("GroupMe refused to transfer ownership: %s (status %s)", result.Status, string(result.Status))
+		return
+	}
+	ce.Reply("Transferred ownership to `%s`", owner)
+}
+
+func fnDestroyGroup(ce *commands.Event) {
+	client, group := getPortalGroup(ce)
+	if client == nil {
+		return
+	}
+	name := ce.Portal.Name
+	commands.StoreCommandState(ce.User, &commands.CommandState{
+		Action: "Destroy GroupMe group",
+		Next: commands.MinimalCommandHandlerFunc(func(ce *commands.Event) {
+			if !strings.EqualFold(strings.TrimSpace(ce.RawArgs), "yes") {
+				ce.Reply("Reply `yes` to destroy **%s** for everyone, or `cancel` to keep it", name)
+				return
+			}
+			commands.StoreCommandState(ce.User, nil)
+			if err := client.Client.DestroyGroup(ce.Ctx, group); err != nil {
+				ce.Reply("Failed to destroy group: %v", err)
+				return
+			}
+			client.queueChatDelete(group)
+			ce.Reply("Destroyed **%s**", name)
+		}),
+	})
+	ce.Reply("This deletes **%s** on GroupMe for all of its members and can't be undone. "+
+		"Reply `yes` to continue, or `cancel` to keep the group", name)
+}
+
+func fnWhoami(ce *commands.Event) {
+	client := getClient(ce)
+	if client == nil {
+		return
+	}
+	user, err := client.Client.MyUser(ce.Ctx)
+	if err != nil {
+		ce.Reply("Failed to get user information: %v", err)
+		return
+	}
+	lines := []string{
+		fmt.Sprintf("Logged in as **%s** (`%s`)", user.Name, user.ID),
+	}
+	if user.Email != "" {
+		lines = append(lines, fmt.Sprintf("* Email: %s", user.Email))
+	}
+	if user.PhoneNumber != "" {
+		lines = append(lines, fmt.Sprintf("* Phone number: %s", user.PhoneNumber))
+	}
+	ce.Reply("%s", strings.Join(lines, "\n"))
+}
@@ -0,0 +1,62 @@
+package connector
+
+import (
+	_ "embed"
+	"time"
+
+	"github.com/GroveJay/matrix-groupme-bridge/pkg/groupmerealtime"
+	up "go.mau.fi/util/configupgrade"
+)
+
+//go:embed example-config.yaml
+var ExampleConfig string
+
+type BlockedDMPolicy string
+
+const (
+	BlockedDMPolicyDrop   BlockedDMPolicy = "drop"
+	BlockedDMPolicyNotice BlockedDMPolicy = "notice"
+	BlockedDMPolicyBridge BlockedDMPolicy = "bridge"
+)
+
+type OAuthConfig struct {
+	ClientID string `yaml:"client_id"`
+}
+
+type PushReconnectConfig struct {
+	InitialDelay time.Duration `yaml:"initial_delay"`
+	MaxDelay     time.Duration `yaml:"max_delay"`
+	Jitter       float64       `yaml:"jitter"`
+	MaxRetries   int           `yaml:"max_retries"`
+}
+
+func (c PushReconnectConfig) policy() groupmerealtime.ReconnectPolicy {
+	return groupmerealtime.ReconnectPolicy{
+		InitialDelay: c.InitialDelay,
+		MaxDelay:     c.MaxDelay,
+		Jitter:       c.Jitter,
+		MaxRetries:   c.MaxRetries,
+	}
+}
+
+type Config struct {
+	BlockedDMPolicy BlockedDMPolicy     `yaml:"blocked_dm_policy"`
+	OAuth           OAuthConfig         `yaml:"oauth"`
+	PushReconnect   PushReconnectConfig `yaml:"push_reconnect"`
+}
+
+func upgradeConfig(helper up.Helper) {
+	helper.Copy(up.Str, "blocked_dm_policy")
+	helper.Copy(up.Str|up.Null, "oauth", "client_id")
+	helper.Copy(up.Str, "push_reconnect", "initial_delay")
+	helper.Copy(up.Str, "push_reconnect", "max_delay")
+	helper.Copy(up.Float, "push_reconnect", "jitter")
+	helper.Copy(up.Int, "push_reconnect", "max_retries")
+}
+
+func (gc *GroupmeConnector) GetConfig() (example string, data any, upgrader up.Upgrader) {
+	return ExampleConfig, &gc.Config, &up.StructUpgrader{
+		SimpleUpgrader: upgradeConfig,
+		Base:           ExampleConfig,
+	}
+}
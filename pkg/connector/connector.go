@@ -2,25 +2,60 @@ package connector
 
 import (
 	"context"
+	"sync"
 
+	"github.com/GroveJay/matrix-groupme-bridge/pkg/faye"
+	"github.com/GroveJay/matrix-groupme-bridge/pkg/groupmeclient"
 	"github.com/GroveJay/matrix-groupme-bridge/pkg/groupmerealtime"
-	"go.mau.fi/util/configupgrade"
 	"maunium.net/go/mautrix/bridgev2"
+	"maunium.net/go/mautrix/bridgev2/commands"
 	"maunium.net/go/mautrix/bridgev2/database"
+	"maunium.net/go/mautrix/bridgev2/matrix"
 )
 
 type GroupmeConnector struct {
-	br *bridgev2.Bridge
+	br           *bridgev2.Bridge
+	provisioning *matrix.ProvisioningAPI
+	Config       Config
+
+	// state -> login, for logins waiting on the OAuth callback
+	oauthLogins     map[string]*GroupmeOAuthLogin
+	oauthLoginsLock sync.Mutex
+	// Where the OAuth endpoints are reachable from browsers, empty if the bridge doesn't know
+	oauthPublicAddress string
+
+	// Only set by tests, to talk to a groupmetest.Server instead of GroupMe
+	clientOptions []groupmeclient.ClientOption
+	pushServer    string
 }
 
 var _ bridgev2.NetworkConnector = (*GroupmeConnector)(nil)
 
 func (gc *GroupmeConnector) Init(bridge *bridgev2.Bridge) {
 	gc.br = bridge
+	gc.br.Commands.(*commands.Processor).AddHandlers(groupmeCommands...)
+}
+
+// newClient creates a GroupMe API client for the token
+func (gc *GroupmeConnector) newClient(authToken string) *groupmeclient.Client {
+	return groupmeclient.NewClient(authToken, gc.clientOptions...)
+}
+
+// newFayeClient creates a client for the GroupMe push server
+func (gc *GroupmeConnector) newFayeClient(logger faye.Logger, authToken string) *faye.FayeClient {
+	if gc.pushServer != "" {
+		return groupmerealtime.NewFayeClientForServer(logger, gc.pushServer, authToken)
+	}
+	return groupmerealtime.NewFayeClient(logger, authToken)
 }
 
 func (gc *GroupmeConnector) Start(ctx context.Context) error {
 	gc.br.Log.Info().Msg("Start")
+	gc.registerProvisioning()
+	gc.registerOAuthCallback()
+	if !gc.br.Config.BridgeMatrixLeave {
+		gc.br.Log.Info().Msg("bridge_matrix_leave is disabled, leaving a portal room won't offer to leave the GroupMe group")
+	}
 	return nil
 }
 
@@ -43,14 +78,12 @@ func (gc *GroupmeConnector) GetName() bridgev2.BridgeName {
 	}
 }
 
-func (gc *GroupmeConnector) GetConfig() (example string, data any, upgrader configupgrade.Upgrader) {
-	return "", nil, configupgrade.NoopUpgrader
-}
-
 func (gc *GroupmeConnector) GetDBMetaTypes() database.MetaTypes {
 	return database.MetaTypes{
-		Portal:   nil,
-		Ghost:    nil,
+		Portal: nil,
+		Ghost: func() any {
+			return &GhostMetadata{}
+		},
 		Message:  nil,
 		Reaction: nil,
 		UserLogin: func() any {
@@ -61,14 +94,27 @@ func (gc *GroupmeConnector) GetDBMetaTypes() database.MetaTypes {
 
 type UserLoginMetadata struct {
 	AuthToken string `json:"authToken"`
+	// SyncedBlocks are the users that were blocked the last time blocks were synced with the Matrix ignore list
+	SyncedBlocks []groupmeclient.ID `json:"syncedBlocks,omitempty"`
+}
+
+var _ database.MetaMerger = (*UserLoginMetadata)(nil)
+
+// CopyFrom takes the token of a new login of the same account, keeping the state of the existing one
+func (meta *UserLoginMetadata) CopyFrom(other any) {
+	if other, ok := other.(*UserLoginMetadata); ok {
+		meta.AuthToken = other.AuthToken
+	}
 }
 
 func (gc *GroupmeConnector) LoadUserLogin(ctx context.Context, login *bridgev2.UserLogin) error {
 	login.Log.Info().Msgf("GroupmeConnector.LoadUserLogin")
 	meta := login.Metadata.(*UserLoginMetadata)
 	pushSubscription := groupmerealtime.NewPushSubscription(ctx)
+	pushSubscription.SetReconnectPolicy(gc.Config.PushReconnect.policy())
 	login.Log.Info().Msgf("GroupmeConnector.LoadUserLogin meta: %s", meta)
 	login.Client = &GroupmeClient{
+		Connector:        gc,
 		UserLogin:        login,
 		PushSubscription: &pushSubscription,
 		AuthToken:        meta.AuthToken,
@@ -0,0 +1,83 @@
+package connector
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/GroveJay/matrix-groupme-bridge/pkg/groupmeclient"
+	"github.com/GroveJay/matrix-groupme-bridge/pkg/groupmerealtime"
+	"github.com/GroveJay/matrix-groupme-bridge/pkg/groupmetest"
+	"github.com/rs/zerolog"
+)
+
+// newTestConnector returns a connector that talks to a fake GroupMe instead of the real one
+func newTestConnector(t *testing.T, me *groupmeclient.User) (*GroupmeConnector, *groupmetest.Server) {
+	t.Helper()
+	server := groupmetest.NewServer("token", me)
+	t.Cleanup(server.Close)
+	return &GroupmeConnector{
+		clientOptions: server.ClientOptions(),
+		pushServer:    server.PushServer(),
+	}, server
+}
+
+func TestNewClientUsesConfiguredServer(t *testing.T) {
+	gc, server := newTestConnector(t, &groupmeclient.User{ID: "1", Name: "Me"})
+	user, err := gc.newClient(server.Token).MyUser(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	} else if user.ID != "1" {
+		t.Errorf("MyUser().ID = %q, want %q", user.ID, "1")
+	}
+	if requests := server.RequestsTo("GET", "/v3/users/me"); len(requests) != 1 {
+		t.Errorf("got %d requests to the fake, want 1", len(requests))
+	}
+}
+
+func TestUserLoginMetadataCopyFrom(t *testing.T) {
+	meta := &UserLoginMetadata{AuthToken: "old", SyncedBlocks: []groupmeclient.ID{"2"}}
+	meta.CopyFrom(&UserLoginMetadata{AuthToken: "new"})
+	if meta.AuthToken != "new" {
+		t.Errorf("AuthToken = %q, want %q", meta.AuthToken, "new")
+	}
+	// Logging in again must not forget which blocks were already synced with Matrix
+	if len(meta.SyncedBlocks) != 1 || meta.SyncedBlocks[0] != "2" {
+		t.Errorf("SyncedBlocks = %v, want [2]", meta.SyncedBlocks)
+	}
+}
+
+func TestIsLoggedInFollowsConnection(t *testing.T) {
+	gc, server := newTestConnector(t, &groupmeclient.User{ID: "1", Name: "Me"})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	subscription := groupmerealtime.NewPushSubscription(ctx)
+	client := &GroupmeClient{PushSubscription: &subscription}
+	defer subscription.Stop()
+
+	if client.IsLoggedIn() {
+		t.Error("IsLoggedIn() = true before connecting")
+	}
+	logger := groupmerealtime.FayeZeroLogger{Logger: zerolog.Nop()}
+	if err := subscription.Setup(ctx, gc.newFayeClient(logger, server.Token)); err != nil {
+		t.Fatal(err)
+	}
+	if !client.IsLoggedIn() {
+		t.Error("IsLoggedIn() = false while connected")
+	}
+
+	client.badCredentials.Store(true)
+	if client.IsLoggedIn() {
+		t.Error("IsLoggedIn() = true with bad credentials")
+	}
+	client.badCredentials.Store(false)
+
+	server.DropPushConnections()
+	for client.IsLoggedIn() {
+		select {
+		case <-time.After(10 * time.Millisecond):
+		case <-ctx.Done():
+			t.Fatal("IsLoggedIn() = true after the push connection dropped")
+		}
+	}
+}
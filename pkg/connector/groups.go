@@ -0,0 +1,197 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/GroveJay/matrix-groupme-bridge/pkg/groupmeclient"
+	"maunium.net/go/mautrix/bridgev2"
+	"maunium.net/go/mautrix/bridgev2/commands"
+	"maunium.net/go/mautrix/bridgev2/networkid"
+	"maunium.net/go/mautrix/bridgev2/simplevent"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/format"
+)
+
+// Errors for joining a group through a share link, also returned by the provisioning API
+var (
+	ErrShareLinkInvalid = bridgev2.RespError{
+		ErrCode:    "COM.GROUPME.SHARE_LINK_INVALID",
+		Err:        "The share link is invalid or has been reset",
+		StatusCode: http.StatusBadRequest,
+	}
+	ErrShareLinkExpired = bridgev2.RespError{
+		ErrCode:    "COM.GROUPME.SHARE_LINK_EXPIRED",
+		Err:        "The share link has expired or sharing was turned off for the group",
+		StatusCode: http.StatusForbidden,
+	}
+	ErrShareLinkGroupNotFound = bridgev2.RespError{
+		ErrCode:    "COM.GROUPME.GROUP_NOT_FOUND",
+		Err:        "The group of the share link doesn't exist anymore",
+		StatusCode: http.StatusNotFound,
+	}
+)
+
+func (groupmeClient *GroupmeClient) portalKey(chat groupmeclient.ID) networkid.PortalKey {
+	return networkid.PortalKey{
+		ID:       MakeGroupmePortalId(chat, groupmeClient.UserLogin.UserLogin.ID),
+		Receiver: groupmeClient.UserLogin.ID,
+	}
+}
+
+// queueChatResync (re)creates the portal of a chat from its current GroupMe state
+func (groupmeClient *GroupmeClient) queueChatResync(chat groupmeclient.ID) {
+	groupmeClient.UserLogin.Bridge.QueueRemoteEvent(groupmeClient.UserLogin, &simplevent.ChatResync{
+		EventMeta: simplevent.EventMeta{
+			Type:         bridgev2.RemoteEventChatResync,
+			LogContext:   GroupLogContext(chat),
+			PortalKey:    groupmeClient.portalKey(chat),
+			CreatePortal: true,
+			Timestamp:    time.Now(),
+		},
+		GetChatInfoFunc: groupmeClient.GetChatInfo,
+	})
+}
+
+// queueChatDelete removes the portal of a chat along with its Matrix room
+func (groupmeClient *GroupmeClient) queueChatDelete(chat groupmeclient.ID) {
+	groupmeClient.UserLogin.Bridge.QueueRemoteEvent(groupmeClient.UserLogin, &simplevent.ChatDelete{
+		EventMeta: simplevent.EventMeta{
+			Type:       bridgev2.RemoteEventChatDelete,
+			LogContext: GroupLogContext(chat),
+			PortalKey:  groupmeClient.portalKey(chat),
+			Timestamp:  time.Now(),
+		},
+		OnlyForMe: true,
+	})
+}
+
+// notifyUser sends a notice to the management room of the user that owns the login
+func (groupmeClient *GroupmeClient) notifyUser(ctx context.Context, message string, args ...any) error {
+	roomID, err := groupmeClient.UserLogin.User.GetManagementRoom(ctx)
+	if err != nil {
+		return err
+	}
+	content := format.RenderMarkdown(fmt.Sprintf(message, args...), true, false)
+	content.MsgType = event.MsgNotice
+	_, err = groupmeClient.UserLogin.Bridge.Bot.SendMessage(ctx, roomID, event.EventMessage, &event.Content{Parsed: &content}, nil)
+	return err
+}
+
+// confirmLeaveGroup asks the user whether leaving a portal room should also remove them from the GroupMe group.
+// Declining puts them back in the room, as they are still a member on GroupMe.
+// This needs bridge_matrix_leave in the bridge config, otherwise leaves aren't passed to the connector.
+func (groupmeClient *GroupmeClient) confirmLeaveGroup(ctx context.Context, group groupmeclient.ID, name string) error {
+	commands.StoreCommandState(groupmeClient.UserLogin.User, &commands.CommandState{
+		Action: "Leave GroupMe group",
+		Next: commands.MinimalCommandHandlerFunc(func(ce *commands.Event) {
+			if !strings.EqualFold(strings.TrimSpace(ce.RawArgs), "yes") {
+				ce.Reply("Reply `yes` to leave **%s** on GroupMe, or `cancel` to stay in the group", name)
+				return
+			}
+			commands.StoreCommandState(ce.User, nil)
+			if err := groupmeClient.leaveGroup(ce.Ctx, group); err != nil {
+				ce.Reply("Failed to leave group: %v", err)
+				groupmeClient.queueChatResync(group)
+				return
+			}
+			ce.Reply("Left **%s**. Use `former-groups` and `rejoin` to join it again", name)
+		}),
+		Cancel: func() {
+			groupmeClient.queueChatResync(group)
+		},
+	})
+	return groupmeClient.notifyUser(ctx, "You left the room for the GroupMe group **%s**. "+
+		"Reply `yes` to leave the group on GroupMe too, or `cancel` to get back into the room", name)
+}
+
+// leaveGroup removes the user from a GroupMe group and cleans up its portal
+func (groupmeClient *GroupmeClient) leaveGroup(ctx context.Context, group groupmeclient.ID) error {
+	member, err := groupmeClient.getMember(ctx, group, groupmeClient.userId)
+	if err != nil {
+		return err
+	}
+	if err := groupmeClient.Client.RemoveMember(ctx, group, member.ID); err != nil {
+		return err
+	}
+	groupmeClient.uncacheMember(group, groupmeClient.userId)
+	groupmeClient.queueChatDelete(group)
+	return nil
+}
+
+// rejoinGroup rejoins a group the user left and recreates its portal
+func (groupmeClient *GroupmeClient) rejoinGroup(ctx context.Context, group groupmeclient.ID) (*groupmeclient.Group, error) {
+	rejoined, err := groupmeClient.Client.RejoinGroup(ctx, group)
+	if err != nil {
+		return nil, err
+	}
+	groupmeClient.queueChatResync(rejoined.ID)
+	return rejoined, nil
+}
+
+// joinGroupByShareURL joins the group of a share link and opens its portal. Once the group is joined
+// the join succeeded, so failing to open the portal right away only leaves it to the background resync.
+func (groupmeClient *GroupmeClient) joinGroupByShareURL(ctx context.Context, shareURL string) (*groupmeclient.Group, *bridgev2.Portal, error) {
+	groupID, shareToken, err := groupmeclient.ParseShareURL(shareURL)
+	if err != nil {
+		return nil, nil, ErrShareLinkInvalid.WithMessage("%s is not a GroupMe share link", shareURL)
+	}
+	group, err := groupmeClient.Client.JoinGroup(ctx, groupID, shareToken)
+	if err != nil {
+		return nil, nil, shareLinkError(err)
+	}
+	portal, err := groupmeClient.openPortal(ctx, group.ID)
+	if err != nil {
+		groupmeClient.UserLogin.Log.Err(err).Str("groupmeID", group.ID.String()).Msg("Failed to open portal of joined group")
+		groupmeClient.queueChatResync(group.ID)
+		return group, nil, nil
+	}
+	return group, portal, nil
+}
+
+// shareLinkError explains why GroupMe refused to join a group through a share link
+func shareLinkError(err error) error {
+	var meta *groupmeclient.Meta
+	if !errors.As(err, &meta) {
+		return err
+	}
+	var respErr bridgev2.RespError
+	switch {
+	case meta.Code == groupmeclient.HTTPBadRequest:
+		respErr = ErrShareLinkInvalid
+	case errors.Is(err, groupmeclient.ErrUnauthorized), errors.Is(err, groupmeclient.ErrForbidden):
+		respErr = ErrShareLinkExpired
+	case errors.Is(err, groupmeclient.ErrNotFound):
+		respErr = ErrShareLinkGroupNotFound
+	default:
+		return err
+	}
+	if len(meta.Errors) > 0 {
+		respErr = respErr.AppendMessage(" (%s)", strings.Join(meta.Errors, ", "))
+	}
+	return respErr
+}
+
+// openPortal creates the Matrix room of a chat right away, or resyncs it if it already exists
+func (groupmeClient *GroupmeClient) openPortal(ctx context.Context, chat groupmeclient.ID) (*bridgev2.Portal, error) {
+	portal, err := groupmeClient.UserLogin.Bridge.GetPortalByKey(ctx, groupmeClient.portalKey(chat))
+	if err != nil {
+		return nil, err
+	}
+	if portal.MXID != "" {
+		groupmeClient.queueChatResync(chat)
+		return portal, nil
+	}
+	info, err := groupmeClient.GetChatInfo(ctx, portal)
+	if err != nil {
+		return nil, err
+	}
+	if err := portal.CreateMatrixRoom(ctx, groupmeClient.UserLogin, info); err != nil {
+		return nil, err
+	}
+	return portal, nil
+}
@@ -2,6 +2,7 @@ package connector
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/url"
@@ -11,11 +12,13 @@ import (
 	"time"
 
 	"github.com/GroveJay/matrix-groupme-bridge/pkg/groupmeclient"
+	"github.com/GroveJay/matrix-groupme-bridge/pkg/groupmerealtime"
 	"github.com/GroveJay/matrix-groupme-bridge/pkg/util"
 	"github.com/rs/zerolog"
 	"maunium.net/go/mautrix/bridgev2"
 	"maunium.net/go/mautrix/bridgev2/networkid"
 	"maunium.net/go/mautrix/bridgev2/simplevent"
+	"maunium.net/go/mautrix/bridgev2/status"
 	"maunium.net/go/mautrix/event"
 )
 
@@ -33,14 +36,53 @@ func ParsePortalId(portalID networkid.PortalID) (*groupmeclient.ID, *networkid.U
 	return &groupmeID, &userLoginID, nil
 }
 
+// Direct message conversations are identified by both user IDs joined with a "+"
+const directMessageSeparator = "+"
+
+// messageChatID returns the group or direct message conversation a message belongs to
+func messageChatID(message groupmeclient.Message) groupmeclient.ID {
+	if message.GroupID != "" {
+		return message.GroupID
+	}
+	return message.ConversationID
+}
+
+// directMessageOtherUser returns the user on the other side of a direct message conversation,
+// or false if the chat is a group
+func directMessageOtherUser(chat groupmeclient.ID, self groupmeclient.ID) (groupmeclient.ID, bool) {
+	first, second, isDM := strings.Cut(chat.String(), directMessageSeparator)
+	if !isDM {
+		return "", false
+	}
+	if groupmeclient.ID(first) == self {
+		return groupmeclient.ID(second), true
+	}
+	return groupmeclient.ID(first), true
+}
+
+// Bots have their own ID space, so their ghosts are prefixed to avoid colliding with users
+const botUserIDPrefix = "bot-"
+
+func MakeGroupmeBotUserId(bot groupmeclient.ID) networkid.UserID {
+	return networkid.UserID(botUserIDPrefix + bot.String())
+}
+
+func ParseBotUserId(userID networkid.UserID) (groupmeclient.ID, bool) {
+	bot, isBot := strings.CutPrefix(string(userID), botUserIDPrefix)
+	return groupmeclient.ID(bot), isBot
+}
+
+func avatarIDFromURL(avatarURL string) networkid.AvatarID {
+	parsedURL, _ := url.Parse(avatarURL)
+	return networkid.AvatarID(path.Base(parsedURL.Path))
+}
+
 func wrapAvatar(avatarURL string) *bridgev2.Avatar {
 	if avatarURL == "" {
 		return &bridgev2.Avatar{Remove: true}
 	}
-	parsedURL, _ := url.Parse(avatarURL)
-	avatarID := path.Base(parsedURL.Path)
 	return &bridgev2.Avatar{
-		ID: networkid.AvatarID(avatarID),
+		ID: avatarIDFromURL(avatarURL),
 		Get: func(ctx context.Context) ([]byte, error) {
 			_, resp, err := util.DownloadMedia(ctx, "image/*", avatarURL, 5*1024*1024, "", false)
 			if err != nil {
@@ -58,9 +100,16 @@ func GroupLogContext(group groupmeclient.ID) func(c zerolog.Context) zerolog.Con
 }
 
 func (groupmeClient *GroupmeClient) SendSimpleEventChatInfoChange(group groupmeclient.ID, logContext func(c zerolog.Context) zerolog.Context, chatInfoChange *bridgev2.ChatInfoChange) {
+	groupmeClient.SendSimpleEventChatInfoChangeFrom(group, bridgev2.EventSender{}, logContext, chatInfoChange)
+}
+
+// SendSimpleEventChatInfoChangeFrom is SendSimpleEventChatInfoChange for changes made by a specific user,
+// e.g. so that a removal is bridged as a kick by the remover rather than a leave
+func (groupmeClient *GroupmeClient) SendSimpleEventChatInfoChangeFrom(group groupmeclient.ID, sender bridgev2.EventSender, logContext func(c zerolog.Context) zerolog.Context, chatInfoChange *bridgev2.ChatInfoChange) {
 	groupmeClient.UserLogin.Bridge.QueueRemoteEvent(groupmeClient.UserLogin, &simplevent.ChatInfoChange{
 		EventMeta: simplevent.EventMeta{
 			Type:       bridgev2.RemoteEventChatInfoChange,
+			Sender:     sender,
 			LogContext: logContext,
 			PortalKey: networkid.PortalKey{
 				ID:       MakeGroupmePortalId(group, groupmeClient.UserLogin.UserLogin.ID),
@@ -75,6 +124,18 @@ func (groupmeClient *GroupmeClient) SendSimpleEventChatInfoChange(group groupmec
 
 func (groupmeClient *GroupmeClient) HandleError(err error) {
 	groupmeClient.UserLogin.Log.Error().Msgf("HandleError (error: %s)", err)
+	if errors.Is(err, groupmerealtime.ErrUnauthorized) {
+		groupmeClient.handleBadCredentials(err)
+	} else if errors.Is(err, groupmerealtime.ErrReconnectFailed) {
+		groupmeClient.UserLogin.BridgeState.Send(status.BridgeState{
+			StateEvent: status.StateUnknownError,
+			Error:      "groupme-push-reconnect-failed",
+			Message:    "Gave up reconnecting to the GroupMe push server",
+			Info: map[string]any{
+				"go_error": err.Error(),
+			},
+		})
+	}
 }
 
 func (groupmeClient *GroupmeClient) HandleGroupAvatar(group groupmeclient.ID, newAvatar string) {
@@ -143,35 +204,22 @@ func (groupmeClient *GroupmeClient) HandleLikeIcon(group groupmeclient.ID, PackI
 
 func (groupmeClient *GroupmeClient) HandleMembers(group groupmeclient.ID, members []groupmeclient.Member, added bool) {
 	groupmeClient.UserLogin.Log.Debug().Msgf("HandleMembers (groupID: %s, members(len): %d, added: %t)", group, len(members), added)
-	memberChanges := &bridgev2.ChatMemberList{}
-	membersToUpdate := []groupmeclient.Member{}
-	if added {
-		membersToUpdate = members
-	} else {
-		memberChanges.IsFull = true
-		ctx := context.Context(context.Background())
-		group, err := groupmeClient.Client.ShowGroup(ctx, group)
-		if err != nil {
-			zerolog.Ctx(context.Background()).Error().Str("groupId", group.ID.String()).Msgf("Error getting group information: %s", err)
-			return
-		}
-		for _, member := range group.Members {
-			membersToUpdate = append(membersToUpdate, *member)
+	if !added {
+		for _, member := range members {
+			groupmeClient.HandleMemberRemoved(group, member, nil)
 		}
+		return
 	}
 
-	memberChanges.MemberMap = make(map[networkid.UserID]bridgev2.ChatMember, len(membersToUpdate))
-	for _, member := range membersToUpdate {
+	memberChanges := &bridgev2.ChatMemberList{
+		MemberMap: make(map[networkid.UserID]bridgev2.ChatMember, len(members)),
+	}
+	for _, member := range members {
 		if _, alreadyExists := memberChanges.MemberMap[networkid.UserID(member.UserID)]; alreadyExists {
-			zerolog.Ctx(context.Background()).Warn().Str("userId", member.UserID.String()).Msg("Duplicate member in list")
-		}
-		memberChanges.MemberMap[networkid.UserID(member.UserID)] = bridgev2.ChatMember{
-			Nickname: &member.Nickname,
-			UserInfo: &bridgev2.UserInfo{
-				Name:   &member.Nickname,
-				Avatar: wrapAvatar(member.ImageURL),
-			},
+			groupmeClient.UserLogin.Log.Warn().Str("userId", member.UserID.String()).Msg("Duplicate member in list")
 		}
+		groupmeClient.cacheMember(group, &member)
+		memberChanges.MemberMap[networkid.UserID(member.UserID)] = groupmeClient.chatMember(&member)
 	}
 	groupmeClient.SendSimpleEventChatInfoChange(
 		group,
@@ -181,6 +229,65 @@ func (groupmeClient *GroupmeClient) HandleMembers(group groupmeclient.ID, member
 		})
 }
 
+func (groupmeClient *GroupmeClient) HandleMemberRoles(group groupmeclient.ID, user groupmeclient.ID, roles []groupmeclient.MemberRole) {
+	groupmeClient.UserLogin.Log.Debug().Msgf("HandleMemberRoles (groupID: %s, userID: %s, roles: %v)", group, user, roles)
+	groupmeClient.updateCachedMember(group, user, func(member *groupmeclient.Member) {
+		member.Roles = roles
+	})
+	ctx := groupmeClient.UserLogin.Log.WithContext(context.Background())
+	isCreator, err := groupmeClient.isGroupCreator(ctx, group, user)
+	if err != nil {
+		groupmeClient.UserLogin.Log.Err(err).Str("groupmeID", group.String()).Msg("Failed to look up the creator of the group")
+	}
+	groupmeClient.SendSimpleEventChatInfoChange(
+		group,
+		func(c zerolog.Context) zerolog.Context {
+			return c.
+				Str("groupmeID", group.String()).
+				Str("userId", user.String())
+		},
+		&bridgev2.ChatInfoChange{
+			MemberChanges: &bridgev2.ChatMemberList{
+				MemberMap: map[networkid.UserID]bridgev2.ChatMember{
+					networkid.UserID(user): {
+						EventSender: groupmeClient.eventSender(user),
+						PowerLevel:  memberPowerLevel(&groupmeclient.Member{UserID: user, Roles: roles}, isCreator),
+					},
+				},
+			},
+		})
+}
+
+func (groupmeClient *GroupmeClient) HandleMemberRemoved(group groupmeclient.ID, removed groupmeclient.Member, remover *groupmeclient.Member) {
+	groupmeClient.UserLogin.Log.Debug().Msgf("HandleMemberRemoved (groupID: %s, userID: %s, kicked: %t)", group, removed.UserID, remover != nil)
+	groupmeClient.uncacheMember(group, removed.UserID)
+	// The sender of the change decides whether Matrix sees a leave or a kick
+	sender := groupmeClient.eventSender(removed.UserID)
+	if remover != nil {
+		sender = groupmeClient.eventSender(remover.UserID)
+	}
+	member := groupmeClient.eventSender(removed.UserID)
+	groupmeClient.SendSimpleEventChatInfoChangeFrom(
+		group,
+		sender,
+		func(c zerolog.Context) zerolog.Context {
+			return c.
+				Str("groupmeID", group.String()).
+				Str("userId", removed.UserID.String())
+		},
+		&bridgev2.ChatInfoChange{
+			MemberChanges: &bridgev2.ChatMemberList{
+				MemberMap: map[networkid.UserID]bridgev2.ChatMember{
+					networkid.UserID(removed.UserID): {
+						EventSender:    member,
+						Membership:     event.MembershipLeave,
+						PrevMembership: event.MembershipJoin,
+					},
+				},
+			},
+		})
+}
+
 func (groupmeClient *GroupmeClient) HandleNewAvatarInGroup(group groupmeclient.ID, user groupmeclient.ID, avatarURL string) {
 	groupmeClient.UserLogin.Log.Debug().Msgf("HandleNewAvatar (groupID: %s, userID: %s, newName: %s)", group, user, avatarURL)
 	groupmeClient.SendSimpleEventChatInfoChange(
@@ -227,24 +334,34 @@ func (groupmeClient *GroupmeClient) HandleNewNickname(group groupmeclient.ID, us
 
 func (groupmeClient *GroupmeClient) HandleTextMessage(message groupmeclient.Message) {
 	groupmeClient.UserLogin.Log.Debug().Msg("HandleTextMessage")
-	isFromMe := false
-	if message.SenderID == groupmeClient.userId {
-		isFromMe = true
+	sender := groupmeClient.eventSender(message.SenderID)
+	if message.SenderType == groupmeclient.SenderTypeBot {
+		sender = groupmeClient.botEventSender(message)
+	}
+	convertMessageFunc := groupmeClient.convertMessage
+	if message.GroupID == "" && !sender.IsFromMe && groupmeClient.isBlocked(message.SenderID) {
+		switch groupmeClient.Connector.Config.BlockedDMPolicy {
+		case BlockedDMPolicyNotice:
+			convertMessageFunc = groupmeClient.convertBlockedMessage
+		case BlockedDMPolicyBridge:
+			// Bridged like any other message
+		default:
+			groupmeClient.UserLogin.Log.Debug().Str("userId", message.SenderID.String()).Msg("Dropping direct message from blocked user")
+			return
+		}
 	}
+	chatID := messageChatID(message)
 	groupmeClient.UserLogin.Bridge.QueueRemoteEvent(groupmeClient.UserLogin, &simplevent.Message[groupmeclient.Message]{
 		EventMeta: simplevent.EventMeta{
-			Sender: bridgev2.EventSender{
-				Sender:   networkid.UserID(message.SenderID),
-				IsFromMe: isFromMe,
-			},
-			Type: bridgev2.RemoteEventMessage,
+			Sender: sender,
+			Type:   bridgev2.RemoteEventMessage,
 			LogContext: func(c zerolog.Context) zerolog.Context {
 				return c.
-					Str("groupmeID", message.GroupID.String()).
+					Str("groupmeID", chatID.String()).
 					Str("userId", message.UserID.String())
 			},
 			PortalKey: networkid.PortalKey{
-				ID:       MakeGroupmePortalId(message.GroupID, groupmeClient.UserLogin.UserLogin.ID),
+				ID:       MakeGroupmePortalId(chatID, groupmeClient.UserLogin.UserLogin.ID),
 				Receiver: groupmeClient.UserLogin.ID,
 			},
 			CreatePortal: true,
@@ -252,10 +369,44 @@ func (groupmeClient *GroupmeClient) HandleTextMessage(message groupmeclient.Mess
 		},
 		Data:               message,
 		ID:                 networkid.MessageID(message.ID),
-		ConvertMessageFunc: groupmeClient.convertMessage,
+		ConvertMessageFunc: convertMessageFunc,
 	})
 }
 
+// botEventSender makes sure the ghost of a bot reflects the name and avatar it sent the message with,
+// as bots aren't users and can't be looked up through GetUserInfo
+func (groupmeClient *GroupmeClient) botEventSender(message groupmeclient.Message) bridgev2.EventSender {
+	ctx := groupmeClient.UserLogin.Log.WithContext(context.Background())
+	userID := MakeGroupmeBotUserId(message.SenderID)
+	ghost, err := groupmeClient.UserLogin.Bridge.GetGhostByID(ctx, userID)
+	if err != nil {
+		groupmeClient.UserLogin.Log.Err(err).Str("botId", message.SenderID.String()).Msg("Failed to get bot ghost")
+	} else {
+		isBot := true
+		ghost.UpdateInfo(ctx, &bridgev2.UserInfo{
+			Name:   &message.Name,
+			Avatar: wrapAvatar(message.AvatarURL),
+			IsBot:  &isBot,
+		})
+	}
+	return bridgev2.EventSender{Sender: userID}
+}
+
+// convertBlockedMessage bridges a message from a blocked user as notices so it stands out
+func (groupmeClient *GroupmeClient) convertBlockedMessage(ctx context.Context, portal *bridgev2.Portal, intent bridgev2.MatrixAPI, data groupmeclient.Message) (*bridgev2.ConvertedMessage, error) {
+	convertedMessage, err := groupmeClient.convertMessage(ctx, portal, intent, data)
+	if err != nil {
+		return nil, err
+	}
+	for _, part := range convertedMessage.Parts {
+		if part.Content.MsgType == event.MsgText {
+			part.Content.MsgType = event.MsgNotice
+			part.Content.Body = "(from blocked user) " + part.Content.Body
+		}
+	}
+	return convertedMessage, nil
+}
+
 func (groupmeClient *GroupmeClient) convertMessage(ctx context.Context, portal *bridgev2.Portal, intent bridgev2.MatrixAPI, data groupmeclient.Message) (*bridgev2.ConvertedMessage, error) {
 	convertedMessage := &bridgev2.ConvertedMessage{}
 	parts := []*bridgev2.ConvertedMessagePart{}
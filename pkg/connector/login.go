@@ -2,15 +2,24 @@ package connector
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
 
 	"github.com/GroveJay/matrix-groupme-bridge/pkg/groupmeclient"
-	"github.com/GroveJay/matrix-groupme-bridge/pkg/groupmerealtime"
 	"maunium.net/go/mautrix/bridgev2"
 	"maunium.net/go/mautrix/bridgev2/database"
 	"maunium.net/go/mautrix/bridgev2/networkid"
+	"maunium.net/go/mautrix/bridgev2/status"
 )
 
+// ErrInvalidAuthToken is returned from the login step when GroupMe doesn't accept the token
+var ErrInvalidAuthToken = bridgev2.RespError{
+	ErrCode:    "COM.GROUPME.INVALID_AUTH_TOKEN",
+	Err:        "GroupMe didn't accept the auth token",
+	StatusCode: http.StatusBadRequest,
+}
+
 type GroupmeLogin struct {
 	User      *bridgev2.User
 	Connector *GroupmeConnector
@@ -22,18 +31,33 @@ type GroupmeLogin struct {
 var _ bridgev2.LoginProcessUserInput = (*GroupmeLogin)(nil)
 
 func (g *GroupmeConnector) CreateLogin(ctx context.Context, user *bridgev2.User, flowID string) (bridgev2.LoginProcess, error) {
-	if flowID != "auth-token" {
+	switch flowID {
+	case "auth-token":
+		return &GroupmeLogin{User: user, Connector: g}, nil
+	case "oauth":
+		if g.Config.OAuth.ClientID == "" {
+			return nil, fmt.Errorf("OAuth login is not configured")
+		}
+		return &GroupmeOAuthLogin{GroupmeLogin: GroupmeLogin{User: user, Connector: g}}, nil
+	default:
 		return nil, fmt.Errorf("unknown login flow ID: %s", flowID)
 	}
-	return &GroupmeLogin{User: user}, nil
 }
 
 func (g *GroupmeConnector) GetLoginFlows() []bridgev2.LoginFlow {
-	return []bridgev2.LoginFlow{{
+	flows := []bridgev2.LoginFlow{{
 		Name:        "Auth token",
 		Description: "Log in with your Groupme access token from https://dev.groupmeclient.com/",
 		ID:          "auth-token",
 	}}
+	if g.Config.OAuth.ClientID != "" {
+		flows = append(flows, bridgev2.LoginFlow{
+			Name:        "GroupMe account",
+			Description: "Log in by authorizing the bridge on the GroupMe website",
+			ID:          "oauth",
+		})
+	}
+	return flows
 }
 
 func (gl *GroupmeLogin) Cancel() {
@@ -60,33 +84,74 @@ func (gl *GroupmeLogin) Start(ctx context.Context) (*bridgev2.LoginStep, error)
 }
 
 func (gl *GroupmeLogin) SubmitUserInput(ctx context.Context, input map[string]string) (*bridgev2.LoginStep, error) {
-	gl.AuthToken = input["auth_token"]
-	pushSubscription := groupmerealtime.NewPushSubscription(ctx)
+	user, err := gl.validateAuthToken(ctx, input["auth_token"])
+	if err != nil {
+		return nil, err
+	}
+	return gl.completeLogin(ctx, user)
+}
+
+// validateAuthToken checks the token against the account it belongs to
+func (gl *GroupmeLogin) validateAuthToken(ctx context.Context, authToken string) (*groupmeclient.User, error) {
+	gl.AuthToken = authToken
+	gl.Client = gl.Connector.newClient(gl.AuthToken)
+	user, err := gl.Client.MyUser(ctx)
+	if err != nil {
+		if errors.Is(err, groupmeclient.ErrUnauthorized) {
+			return nil, ErrInvalidAuthToken
+		}
+		return nil, fmt.Errorf("failed to validate auth token: %w", err)
+	}
+	gl.UserId = user.ID
+	return user, nil
+}
+
+// completeLogin creates the login of a validated GroupMe account and connects it.
+// Logging in to an account again replaces its previous login, even if it belonged to another Matrix user.
+func (gl *GroupmeLogin) completeLogin(ctx context.Context, user *groupmeclient.User) (*bridgev2.LoginStep, error) {
+	var oldClient bridgev2.NetworkAPI
 	userLogin, err := gl.User.NewLogin(ctx, &database.UserLogin{
-		ID:         networkid.UserLoginID(gl.UserId),
-		RemoteName: gl.UserId.String(),
+		ID:            networkid.UserLoginID(user.ID),
+		RemoteName:    user.Name,
+		RemoteProfile: remoteProfile(user),
 		Metadata: &UserLoginMetadata{
 			AuthToken: gl.AuthToken,
 		},
 	}, &bridgev2.NewLoginParams{
+		DeleteOnConflict: true,
 		LoadUserLogin: func(ctx context.Context, login *bridgev2.UserLogin) error {
-			login.Client = &GroupmeClient{
-				UserLogin:        login,
-				PushSubscription: &pushSubscription,
-				AuthToken:        gl.AuthToken,
-			}
-			return nil
+			// Re-login of an existing account, the old client is disconnected once the bridge released its locks
+			oldClient = login.Client
+			return gl.Connector.LoadUserLogin(ctx, login)
 		},
 	})
 	if err != nil {
+		if oldClient != nil {
+			go oldClient.Disconnect()
+		}
 		return nil, err
 	}
+	go func() {
+		if oldClient != nil {
+			oldClient.Disconnect()
+		}
+		userLogin.Client.Connect(userLogin.Log.WithContext(context.Background()))
+	}()
 	return &bridgev2.LoginStep{
 		Type:         bridgev2.LoginStepTypeComplete,
 		StepID:       "groupmeclient.complete",
-		Instructions: "Successfully logged in",
+		Instructions: fmt.Sprintf("Successfully logged in as %s", user.Name),
 		CompleteParams: &bridgev2.LoginCompleteParams{
-			UserLogin: userLogin,
+			UserLoginID: userLogin.ID,
+			UserLogin:   userLogin,
 		},
 	}, nil
 }
+
+func remoteProfile(user *groupmeclient.User) status.RemoteProfile {
+	return status.RemoteProfile{
+		Name:  user.Name,
+		Email: user.Email,
+		Phone: user.PhoneNumber.String(),
+	}
+}
@@ -0,0 +1,172 @@
+package connector
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/GroveJay/matrix-groupme-bridge/pkg/groupmeclient"
+	"maunium.net/go/mautrix/bridgev2"
+	"maunium.net/go/mautrix/event"
+)
+
+var (
+	_ bridgev2.RoomNameHandlingNetworkAPI   = (*GroupmeClient)(nil)
+	_ bridgev2.RoomTopicHandlingNetworkAPI  = (*GroupmeClient)(nil)
+	_ bridgev2.RoomAvatarHandlingNetworkAPI = (*GroupmeClient)(nil)
+	_ bridgev2.MuteHandlingNetworkAPI       = (*GroupmeClient)(nil)
+)
+
+// updateGroupSettings fetches the current settings of the portal's group, applies
+// the change and pushes the result so the other settings are preserved
+func (groupmeClient *GroupmeClient) updateGroupSettings(ctx context.Context, portal *bridgev2.Portal, change func(*groupmeclient.GroupSettings)) (*groupmeclient.Group, error) {
+	groupID, _, err := ParsePortalId(portal.ID)
+	if err != nil {
+		return nil, err
+	}
+	group, err := groupmeClient.Client.ShowGroup(ctx, *groupID)
+	if err != nil {
+		return nil, wrapGroupmeError(err)
+	}
+	settings := group.Settings()
+	change(&settings)
+	group, err = groupmeClient.Client.UpdateGroup(ctx, *groupID, settings)
+	if err != nil {
+		return nil, wrapGroupmeError(err)
+	}
+	return group, nil
+}
+
+// wrapGroupmeError turns errors from GroupMe into a message status
+// so the Matrix user can see why their event was rejected
+func wrapGroupmeError(err error) error {
+	var meta *groupmeclient.Meta
+	if !errors.As(err, &meta) {
+		return err
+	}
+	statusErr := bridgev2.WrapErrorInStatus(err).
+		WithStatus(event.MessageStatusFail).
+		WithErrorReason(event.MessageStatusNetworkError).
+		WithIsCertain(true).
+		WithSendNotice(true)
+	switch {
+	case errors.Is(err, groupmeclient.ErrUnauthorized):
+		return statusErr.
+			WithErrorReason(event.MessageStatusNoPermission).
+			WithMessage("GroupMe rejected the access token, please log in again")
+	case errors.Is(err, groupmeclient.ErrForbidden):
+		return statusErr.
+			WithErrorReason(event.MessageStatusNoPermission).
+			WithMessage("You don't have permission to do that in this GroupMe chat")
+	case errors.Is(err, groupmeclient.ErrNotFound):
+		return statusErr.WithMessage("The GroupMe chat or user no longer exists")
+	case errors.Is(err, groupmeclient.ErrRateLimited):
+		return statusErr.
+			WithStatus(event.MessageStatusRetriable).
+			WithMessage("GroupMe is rate limiting this account, try again later")
+	case meta.Code >= groupmeclient.HTTPInternalServerError:
+		return statusErr.
+			WithStatus(event.MessageStatusRetriable).
+			WithMessage("GroupMe is having problems, try again later")
+	case len(meta.Errors) > 0:
+		return statusErr.WithMessage("GroupMe rejected the request: " + strings.Join(meta.Errors, ", "))
+	default:
+		return statusErr
+	}
+}
+
+func (groupmeClient *GroupmeClient) HandleMatrixRoomName(ctx context.Context, msg *bridgev2.MatrixRoomName) (bool, error) {
+	groupmeClient.UserLogin.Log.Info().Msgf("GroupmeClient.HandleMatrixRoomName: portal %s", msg.Portal.ID)
+	group, err := groupmeClient.updateGroupSettings(ctx, msg.Portal, func(settings *groupmeclient.GroupSettings) {
+		settings.Name = msg.Content.Name
+	})
+	if err != nil {
+		return false, err
+	}
+	msg.Portal.Name = group.Name
+	msg.Portal.NameSet = true
+	return true, nil
+}
+
+func (groupmeClient *GroupmeClient) HandleMatrixRoomTopic(ctx context.Context, msg *bridgev2.MatrixRoomTopic) (bool, error) {
+	groupmeClient.UserLogin.Log.Info().Msgf("GroupmeClient.HandleMatrixRoomTopic: portal %s", msg.Portal.ID)
+	group, err := groupmeClient.updateGroupSettings(ctx, msg.Portal, func(settings *groupmeclient.GroupSettings) {
+		settings.Description = msg.Content.Topic
+	})
+	if err != nil {
+		return false, err
+	}
+	msg.Portal.Topic = group.Description
+	msg.Portal.TopicSet = true
+	return true, nil
+}
+
+func (groupmeClient *GroupmeClient) HandleMatrixRoomAvatar(ctx context.Context, msg *bridgev2.MatrixRoomAvatar) (bool, error) {
+	groupmeClient.UserLogin.Log.Info().Msgf("GroupmeClient.HandleMatrixRoomAvatar: portal %s", msg.Portal.ID)
+	var imageURL string
+	var avatarHash [32]byte
+	if msg.Content.URL != "" {
+		data, err := groupmeClient.UserLogin.Bridge.Bot.DownloadMedia(ctx, msg.Content.URL, nil)
+		if err != nil {
+			return false, err
+		}
+		uploaded, err := groupmeClient.Client.UploadImage(ctx, data, http.DetectContentType(data))
+		if err != nil {
+			return false, wrapGroupmeError(err)
+		}
+		imageURL = uploaded.PictureURL
+		avatarHash = sha256.Sum256(data)
+	}
+	group, err := groupmeClient.updateGroupSettings(ctx, msg.Portal, func(settings *groupmeclient.GroupSettings) {
+		settings.ImageURL = imageURL
+	})
+	if err != nil {
+		return false, err
+	}
+	msg.Portal.AvatarID = ""
+	if group.ImageURL != "" {
+		msg.Portal.AvatarID = avatarIDFromURL(group.ImageURL)
+	}
+	msg.Portal.AvatarHash = avatarHash
+	msg.Portal.AvatarMXC = msg.Content.URL
+	msg.Portal.AvatarSet = true
+	return true, nil
+}
+
+func (groupmeClient *GroupmeClient) HandleMute(ctx context.Context, msg *bridgev2.MatrixMute) error {
+	groupmeClient.UserLogin.Log.Info().Msgf("GroupmeClient.HandleMute: portal %s", msg.Portal.ID)
+	groupID, _, err := ParsePortalId(msg.Portal.ID)
+	if err != nil {
+		return err
+	}
+	if _, isDM := directMessageOtherUser(*groupID, groupmeClient.userId); isDM {
+		// DMs have no membership to mute on GroupMe, so the mute stays on Matrix
+		return nil
+	}
+	if !msg.Content.IsMuted() {
+		_, err = groupmeClient.Client.UnmuteMembership(ctx, *groupID)
+		return wrapGroupmeError(err)
+	}
+	var duration time.Duration
+	if mutedUntil := msg.Content.GetMutedUntilTime(); mutedUntil != event.MutedForever {
+		duration = time.Until(mutedUntil)
+	}
+	_, err = groupmeClient.Client.MuteMembership(ctx, *groupID, duration)
+	return wrapGroupmeError(err)
+}
+
+// userLocalInfo bridges the logged in user's mute state of a group to a push rule and a low priority tag.
+// The tag is left alone when the group isn't muted, an empty tag would clear the tags the user set.
+func userLocalInfo(muted bool) *bridgev2.UserLocalPortalInfo {
+	mutedUntil := bridgev2.Unmuted
+	info := &bridgev2.UserLocalPortalInfo{MutedUntil: &mutedUntil}
+	if muted {
+		mutedUntil = event.MutedForever
+		tag := event.RoomTagLowPriority
+		info.Tag = &tag
+	}
+	return info
+}
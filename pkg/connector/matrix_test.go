@@ -0,0 +1,53 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/GroveJay/matrix-groupme-bridge/pkg/groupmeclient"
+	"github.com/GroveJay/matrix-groupme-bridge/pkg/groupmetest"
+	"maunium.net/go/mautrix/bridgev2"
+	"maunium.net/go/mautrix/bridgev2/database"
+	"maunium.net/go/mautrix/event"
+)
+
+func TestUserLocalInfo(t *testing.T) {
+	muted := userLocalInfo(true)
+	if muted.MutedUntil == nil || *muted.MutedUntil != event.MutedForever {
+		t.Errorf("MutedUntil of a muted group = %v, want muted forever", muted.MutedUntil)
+	}
+	if muted.Tag == nil || *muted.Tag != event.RoomTagLowPriority {
+		t.Errorf("Tag of a muted group = %v, want low priority", muted.Tag)
+	}
+
+	unmuted := userLocalInfo(false)
+	if unmuted.MutedUntil == nil || *unmuted.MutedUntil != bridgev2.Unmuted {
+		t.Errorf("MutedUntil of an unmuted group = %v, want unmuted", unmuted.MutedUntil)
+	}
+	// An empty tag would clear the tags the user set themselves
+	if unmuted.Tag != nil {
+		t.Errorf("Tag of an unmuted group = %q, want nil", *unmuted.Tag)
+	}
+}
+
+func TestHandleMatrixReadReceiptWrapsErrors(t *testing.T) {
+	server := groupmetest.NewServer("token", &groupmeclient.User{ID: "1", Name: "Me"})
+	defer server.Close()
+	server.Fail("POST", "/v3/read_receipts", groupmeclient.HTTPForbidden, 1)
+	client, _ := newLeaveTestClient()
+	client.Client = server.NewClient()
+	receipt := &bridgev2.MatrixReadReceipt{
+		Portal:       &bridgev2.Portal{Portal: &database.Portal{PortalKey: client.portalKey("10")}},
+		ExactMessage: &database.Message{ID: "100"},
+	}
+
+	err := client.HandleMatrixReadReceipt(context.Background(), receipt)
+	var status bridgev2.MessageStatus
+	if !errors.As(err, &status) {
+		t.Fatalf("HandleMatrixReadReceipt() = %v, want a message status", err)
+	}
+	if status.ErrorReason != event.MessageStatusNoPermission {
+		t.Errorf("error reason = %s, want %s", status.ErrorReason, event.MessageStatusNoPermission)
+	}
+}
@@ -0,0 +1,238 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/GroveJay/matrix-groupme-bridge/pkg/groupmeclient"
+	"maunium.net/go/mautrix/bridgev2"
+	"maunium.net/go/mautrix/bridgev2/networkid"
+	"maunium.net/go/mautrix/event"
+)
+
+// Power levels GroupMe roles are mapped to in portal rooms
+const (
+	powerLevelMember    = 0
+	powerLevelModerator = 50
+	powerLevelOwner     = 100
+)
+
+// How long an invite waits for GroupMe to process the asynchronous add request
+const addMemberTimeout = 30 * time.Second
+
+// GroupMe rejects nicknames that are empty or longer than this many characters
+const maxNicknameLength = 50
+
+var _ bridgev2.MembershipHandlingNetworkAPI = (*GroupmeClient)(nil)
+
+// cacheGroupMembers replaces the cached member list of a group
+func (groupmeClient *GroupmeClient) cacheGroupMembers(group *groupmeclient.Group) {
+	groupmeClient.groupMembersLock.Lock()
+	defer groupmeClient.groupMembersLock.Unlock()
+	if groupmeClient.groupMembers == nil {
+		groupmeClient.groupMembers = make(map[groupmeclient.ID]map[groupmeclient.ID]*groupmeclient.Member)
+	}
+	members := make(map[groupmeclient.ID]*groupmeclient.Member, len(group.Members))
+	for _, member := range group.Members {
+		members[member.UserID] = member
+	}
+	groupmeClient.groupMembers[group.ID] = members
+	if groupmeClient.groupCreators == nil {
+		groupmeClient.groupCreators = make(map[groupmeclient.ID]groupmeclient.ID)
+	}
+	groupmeClient.groupCreators[group.ID] = group.CreatorUserID
+}
+
+// cacheMember adds or replaces a single member of a group that has already been cached
+func (groupmeClient *GroupmeClient) cacheMember(group groupmeclient.ID, member *groupmeclient.Member) {
+	groupmeClient.groupMembersLock.Lock()
+	defer groupmeClient.groupMembersLock.Unlock()
+	if members, ok := groupmeClient.groupMembers[group]; ok {
+		members[member.UserID] = member
+	}
+}
+
+// updateCachedMember changes a cached member in place, if it is known
+func (groupmeClient *GroupmeClient) updateCachedMember(group groupmeclient.ID, user groupmeclient.ID, update func(*groupmeclient.Member)) {
+	groupmeClient.groupMembersLock.Lock()
+	defer groupmeClient.groupMembersLock.Unlock()
+	if member, ok := groupmeClient.groupMembers[group][user]; ok {
+		update(member)
+	}
+}
+
+func (groupmeClient *GroupmeClient) uncacheMember(group groupmeclient.ID, user groupmeclient.ID) {
+	groupmeClient.groupMembersLock.Lock()
+	defer groupmeClient.groupMembersLock.Unlock()
+	delete(groupmeClient.groupMembers[group], user)
+}
+
+func (groupmeClient *GroupmeClient) getCachedMember(group groupmeclient.ID, user groupmeclient.ID) *groupmeclient.Member {
+	groupmeClient.groupMembersLock.Lock()
+	defer groupmeClient.groupMembersLock.Unlock()
+	return groupmeClient.groupMembers[group][user]
+}
+
+// isGroupCreator checks if the user created the group, fetching the group when it hasn't been cached yet
+func (groupmeClient *GroupmeClient) isGroupCreator(ctx context.Context, group groupmeclient.ID, user groupmeclient.ID) (bool, error) {
+	groupmeClient.groupMembersLock.Lock()
+	creator, ok := groupmeClient.groupCreators[group]
+	groupmeClient.groupMembersLock.Unlock()
+	if ok {
+		return creator == user, nil
+	}
+	fullGroup, err := groupmeClient.Client.ShowGroup(ctx, group)
+	if err != nil {
+		return false, err
+	}
+	groupmeClient.cacheGroupMembers(fullGroup)
+	return fullGroup.CreatorUserID == user, nil
+}
+
+// getMember returns the membership of a user in a group, only refetching the group
+// when the member is unknown or was cached from a push event without a membership ID
+func (groupmeClient *GroupmeClient) getMember(ctx context.Context, group groupmeclient.ID, user groupmeclient.ID) (*groupmeclient.Member, error) {
+	if member := groupmeClient.getCachedMember(group, user); member != nil && member.ID != "" {
+		return member, nil
+	}
+	fullGroup, err := groupmeClient.Client.ShowGroup(ctx, group)
+	if err != nil {
+		return nil, err
+	}
+	groupmeClient.cacheGroupMembers(fullGroup)
+	if member := groupmeClient.getCachedMember(group, user); member != nil {
+		return member, nil
+	}
+	return nil, fmt.Errorf("user %s is not a member of group %s", user, group)
+}
+
+func membershipTargetID(target bridgev2.GhostOrUserLogin) (groupmeclient.ID, string, error) {
+	switch target := target.(type) {
+	case *bridgev2.Ghost:
+		return groupmeclient.ID(target.ID), memberNickname(target.Name, groupmeclient.ID(target.ID)), nil
+	case *bridgev2.UserLogin:
+		return groupmeclient.ID(target.ID), memberNickname(target.RemoteName, groupmeclient.ID(target.ID)), nil
+	default:
+		return "", "", errors.New("membership target is not a GroupMe user")
+	}
+}
+
+// memberNickname makes a name acceptable as a GroupMe nickname, falling back to the user ID for unnamed users
+func memberNickname(name string, user groupmeclient.ID) string {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = user.String()
+	}
+	if runes := []rune(name); len(runes) > maxNicknameLength {
+		name = string(runes[:maxNicknameLength])
+	}
+	return name
+}
+
+func (groupmeClient *GroupmeClient) HandleMatrixMembership(ctx context.Context, msg *bridgev2.MatrixMembershipChange) (bool, error) {
+	groupmeClient.UserLogin.Log.Info().Msgf("GroupmeClient.HandleMatrixMembership: portal %s", msg.Portal.ID)
+	groupID, _, err := ParsePortalId(msg.Portal.ID)
+	if err != nil {
+		return false, err
+	}
+	switch msg.Type {
+	case bridgev2.Invite:
+		userID, nickname, err := membershipTargetID(msg.Target)
+		if err != nil {
+			return false, err
+		}
+		resultsID, err := groupmeClient.Client.AddMembers(ctx, *groupID, &groupmeclient.Member{
+			UserID:   userID,
+			Nickname: nickname,
+		})
+		if err != nil {
+			return false, wrapGroupmeError(err)
+		}
+		added, err := groupmeClient.Client.MemberResults(ctx, *groupID, resultsID, addMemberTimeout)
+		if err != nil {
+			return false, wrapGroupmeError(err)
+		}
+		if len(added) == 0 {
+			return false, fmt.Errorf("GroupMe did not add user %s to the group", userID)
+		}
+		groupmeClient.cacheMember(*groupID, added[0])
+		return true, nil
+	case bridgev2.Kick, bridgev2.RevokeInvite:
+		userID, _, err := membershipTargetID(msg.Target)
+		if err != nil {
+			return false, err
+		}
+		member, err := groupmeClient.getMember(ctx, *groupID, userID)
+		if err != nil {
+			return false, err
+		}
+		if err := groupmeClient.Client.RemoveMember(ctx, *groupID, member.ID); err != nil {
+			return false, wrapGroupmeError(err)
+		}
+		groupmeClient.uncacheMember(*groupID, userID)
+		return true, nil
+	case bridgev2.Leave:
+		// bridgev2 only passes leaves on with bridge_matrix_leave enabled in the bridge config
+		if _, isDM := directMessageOtherUser(*groupID, groupmeClient.userId); isDM {
+			return false, nil
+		}
+		// Leaving a room is easy to do by accident, so only leave the GroupMe group once the user confirms
+		if err := groupmeClient.confirmLeaveGroup(ctx, *groupID, msg.Portal.Name); err != nil {
+			return false, err
+		}
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+// chatMember converts a GroupMe member into the bridgev2 representation, keyed by their user ID
+func (groupmeClient *GroupmeClient) chatMember(member *groupmeclient.Member) bridgev2.ChatMember {
+	chatMember := bridgev2.ChatMember{
+		EventSender: groupmeClient.eventSender(member.UserID),
+		Membership:  event.MembershipJoin,
+		Nickname:    &member.Nickname,
+		UserInfo: &bridgev2.UserInfo{
+			Name: &member.Nickname,
+		},
+	}
+	if member.AutoKicked {
+		chatMember.Membership = event.MembershipBan
+	}
+	// Members from push events only carry an id and nickname
+	if member.ImageURL != "" {
+		chatMember.UserInfo.Avatar = wrapAvatar(member.ImageURL)
+	}
+	return chatMember
+}
+
+func (groupmeClient *GroupmeClient) eventSender(user groupmeclient.ID) bridgev2.EventSender {
+	return bridgev2.EventSender{
+		Sender:   networkid.UserID(user),
+		IsFromMe: user == groupmeClient.userId,
+	}
+}
+
+// memberPowerLevel maps the GroupMe roles of a member to a Matrix power level,
+// the creator of the group is always treated as its owner
+func memberPowerLevel(member *groupmeclient.Member, isCreator bool) *int {
+	level := powerLevelMember
+	if isCreator || member.HasRole(groupmeclient.MemberRoleOwner) {
+		level = powerLevelOwner
+	} else if member.HasRole(groupmeclient.MemberRoleAdmin) {
+		level = powerLevelModerator
+	}
+	return &level
+}
+
+// groupPowerLevels only lets GroupMe admins remove members from the portal
+func groupPowerLevels() *bridgev2.PowerLevelOverrides {
+	moderator := powerLevelModerator
+	return &bridgev2.PowerLevelOverrides{
+		Kick: &moderator,
+		Ban:  &moderator,
+	}
+}
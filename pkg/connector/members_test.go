@@ -0,0 +1,99 @@
+package connector
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/GroveJay/matrix-groupme-bridge/pkg/groupmeclient"
+	"github.com/rs/zerolog"
+	"maunium.net/go/mautrix"
+	"maunium.net/go/mautrix/bridgev2"
+	"maunium.net/go/mautrix/bridgev2/database"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+)
+
+func TestMemberNickname(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Alice", "Alice"},
+		{"", "42"},
+		{"   ", "42"},
+		{strings.Repeat("a", 60), strings.Repeat("a", maxNicknameLength)},
+		{strings.Repeat("é", 60), strings.Repeat("é", maxNicknameLength)},
+	}
+	for _, test := range tests {
+		if got := memberNickname(test.name, "42"); got != test.want {
+			t.Errorf("memberNickname(%q) = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+// recordingBot is the bridge bot, it only records the messages that are sent
+type recordingBot struct {
+	bridgev2.MatrixAPI
+	sent []id.RoomID
+}
+
+func (b *recordingBot) SendMessage(ctx context.Context, roomID id.RoomID, eventType event.Type, content *event.Content, extra *bridgev2.MatrixSendExtra) (*mautrix.RespSendEvent, error) {
+	b.sent = append(b.sent, roomID)
+	return &mautrix.RespSendEvent{}, nil
+}
+
+func newLeaveTestClient() (*GroupmeClient, *recordingBot) {
+	bot := &recordingBot{}
+	br := &bridgev2.Bridge{Bot: bot}
+	login := &bridgev2.UserLogin{
+		UserLogin: &database.UserLogin{ID: "1"},
+		Bridge:    br,
+		User:      &bridgev2.User{User: &database.User{ManagementRoom: "!management:example.com"}, Bridge: br},
+		Log:       zerolog.Nop(),
+	}
+	return &GroupmeClient{UserLogin: login, userId: "1"}, bot
+}
+
+func leaveOf(client *GroupmeClient, chat groupmeclient.ID) *bridgev2.MatrixMembershipChange {
+	portal := &bridgev2.Portal{Portal: &database.Portal{PortalKey: client.portalKey(chat)}}
+	return &bridgev2.MatrixMembershipChange{
+		MatrixRoomMeta: bridgev2.MatrixRoomMeta[*event.MemberEventContent]{
+			MatrixEventBase: bridgev2.MatrixEventBase[*event.MemberEventContent]{Portal: portal},
+		},
+		Target: client.UserLogin,
+		Type:   bridgev2.Leave,
+	}
+}
+
+func TestHandleMatrixMembershipLeave(t *testing.T) {
+	client, bot := newLeaveTestClient()
+
+	handled, err := client.HandleMatrixMembership(context.Background(), leaveOf(client, "10"))
+	if err != nil {
+		t.Fatal(err)
+	} else if !handled {
+		t.Error("HandleMatrixMembership() = false for leaving a group, want true")
+	}
+	// The group is only left on GroupMe once the user confirms in the management room
+	if client.UserLogin.User.CommandState == nil {
+		t.Error("no confirmation is pending after leaving the room")
+	}
+	if len(bot.sent) != 1 || bot.sent[0] != "!management:example.com" {
+		t.Errorf("sent messages to %v, want the management room", bot.sent)
+	}
+}
+
+func TestHandleMatrixMembershipLeaveDM(t *testing.T) {
+	client, bot := newLeaveTestClient()
+
+	handled, err := client.HandleMatrixMembership(context.Background(), leaveOf(client, "1+2"))
+	if err != nil {
+		t.Fatal(err)
+	} else if handled {
+		t.Error("HandleMatrixMembership() = true for leaving a DM, want false")
+	}
+	if client.UserLogin.User.CommandState != nil || len(bot.sent) != 0 {
+		t.Error("leaving a DM asked for a confirmation")
+	}
+}
@@ -0,0 +1,185 @@
+package connector
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"maunium.net/go/mautrix/bridgev2"
+	"maunium.net/go/mautrix/bridgev2/matrix"
+)
+
+const (
+	oauthAuthorizeURL = "https://oauth.groupme.com/oauth/authorize"
+	oauthStartPath    = "/groupme/oauth/start"
+	oauthCallbackPath = "/groupme/oauth/callback"
+	// Remembers which login the browser started, GroupMe only documents passing the access token to the callback
+	oauthLoginCookie = "groupme_oauth_login"
+
+	// How long the bridge waits for the user to authorize it on the GroupMe website
+	oauthLoginTimeout = 10 * time.Minute
+)
+
+// GroupmeOAuthLogin logs in with the implicit grant of a GroupMe application.
+// GroupMe redirects to the callback endpoint with the access token once the user authorizes the bridge.
+type GroupmeOAuthLogin struct {
+	GroupmeLogin
+	state  string
+	tokens chan string
+}
+
+var _ bridgev2.LoginProcessDisplayAndWait = (*GroupmeOAuthLogin)(nil)
+
+func (gol *GroupmeOAuthLogin) Start(ctx context.Context) (*bridgev2.LoginStep, error) {
+	state := make([]byte, 16)
+	if _, err := rand.Read(state); err != nil {
+		return nil, err
+	}
+	gol.state = hex.EncodeToString(state)
+	gol.tokens = make(chan string, 1)
+	gol.Connector.addOAuthLogin(gol)
+
+	// Going through the bridge first lets it set the cookie that identifies the login in the callback
+	loginURL := gol.Connector.oauthAuthorizeURL(gol.state)
+	if publicAddress := gol.Connector.oauthPublicAddress; publicAddress != "" {
+		loginURL = publicAddress + oauthStartPath + "?" + url.Values{"login": {gol.state}}.Encode()
+	}
+	return &bridgev2.LoginStep{
+		Type:         bridgev2.LoginStepTypeDisplayAndWait,
+		StepID:       "groupmeclient.oauth_authorize",
+		Instructions: fmt.Sprintf("Open %s and authorize the bridge to log in", loginURL),
+		DisplayAndWaitParams: &bridgev2.LoginDisplayAndWaitParams{
+			Type: bridgev2.LoginDisplayTypeNothing,
+		},
+	}, nil
+}
+
+func (gol *GroupmeOAuthLogin) Wait(ctx context.Context) (*bridgev2.LoginStep, error) {
+	defer gol.Connector.removeOAuthLogin(gol)
+	select {
+	case authToken := <-gol.tokens:
+		user, err := gol.validateAuthToken(ctx, authToken)
+		if err != nil {
+			return nil, err
+		}
+		return gol.completeLogin(ctx, user)
+	case <-time.After(oauthLoginTimeout):
+		return nil, fmt.Errorf("timed out waiting for GroupMe authorization")
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (gol *GroupmeOAuthLogin) Cancel() {
+	gol.Connector.removeOAuthLogin(gol)
+}
+
+func (gc *GroupmeConnector) addOAuthLogin(login *GroupmeOAuthLogin) {
+	gc.oauthLoginsLock.Lock()
+	defer gc.oauthLoginsLock.Unlock()
+	if gc.oauthLogins == nil {
+		gc.oauthLogins = make(map[string]*GroupmeOAuthLogin)
+	}
+	gc.oauthLogins[login.state] = login
+}
+
+func (gc *GroupmeConnector) removeOAuthLogin(login *GroupmeOAuthLogin) {
+	gc.oauthLoginsLock.Lock()
+	defer gc.oauthLoginsLock.Unlock()
+	delete(gc.oauthLogins, login.state)
+}
+
+// getOAuthLogin finds the login a callback is for by the state it was started with
+func (gc *GroupmeConnector) getOAuthLogin(state string) *GroupmeOAuthLogin {
+	gc.oauthLoginsLock.Lock()
+	defer gc.oauthLoginsLock.Unlock()
+	return gc.oauthLogins[state]
+}
+
+// oauthAuthorizeURL is the GroupMe page where the user authorizes the bridge
+func (gc *GroupmeConnector) oauthAuthorizeURL(state string) string {
+	authorizeURL, _ := url.Parse(oauthAuthorizeURL)
+	query := authorizeURL.Query()
+	query.Set("client_id", gc.Config.OAuth.ClientID)
+	query.Set("state", state)
+	authorizeURL.RawQuery = query.Encode()
+	return authorizeURL.String()
+}
+
+// registerOAuthCallback adds the endpoints for starting the login and the one GroupMe redirects to
+// after authorizing to the appservice listener
+func (gc *GroupmeConnector) registerOAuthCallback() {
+	if gc.Config.OAuth.ClientID == "" {
+		return
+	}
+	matrixConnector, ok := gc.br.Matrix.(*matrix.Connector)
+	if !ok || matrixConnector.AS == nil {
+		gc.br.Log.Warn().Msg("OAuth login is configured, but there is no HTTP listener for its callback")
+		return
+	}
+	gc.oauthPublicAddress = strings.TrimSuffix(matrixConnector.GetPublicAddress(), "/")
+	if gc.oauthPublicAddress == "" {
+		gc.br.Log.Warn().Msg("OAuth login is configured without appservice.public_address, logins only complete if GroupMe passes the state to the callback")
+	}
+	matrixConnector.AS.Router.HandleFunc(oauthStartPath, gc.handleOAuthStart).Methods(http.MethodGet)
+	matrixConnector.AS.Router.HandleFunc(oauthCallbackPath, gc.handleOAuthCallback).Methods(http.MethodGet)
+}
+
+// handleOAuthStart remembers the login in a cookie and sends the browser on to GroupMe
+func (gc *GroupmeConnector) handleOAuthStart(w http.ResponseWriter, r *http.Request) {
+	login := gc.getOAuthLogin(r.URL.Query().Get("login"))
+	if login == nil {
+		http.Error(w, "No matching login is in progress, start the login again from Matrix", http.StatusNotFound)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oauthLoginCookie,
+		Value:    login.state,
+		Path:     oauthCallbackPath,
+		MaxAge:   int(oauthLoginTimeout.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil || strings.HasPrefix(gc.oauthPublicAddress, "https://"),
+		// Lax cookies are still sent on the redirect back from GroupMe
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, gc.oauthAuthorizeURL(login.state), http.StatusFound)
+}
+
+func (gc *GroupmeConnector) handleOAuthCallback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	authToken := query.Get("access_token")
+	if authToken == "" {
+		http.Error(w, "Missing access token", http.StatusBadRequest)
+		return
+	}
+	// GroupMe only documents passing the access token, so the login is usually found through the cookie
+	// set by handleOAuthStart. Without either anyone could send their own token to a pending login.
+	state := query.Get("state")
+	if state == "" {
+		if cookie, err := r.Cookie(oauthLoginCookie); err == nil {
+			state = cookie.Value
+		}
+	}
+	if state == "" {
+		http.Error(w, "Unknown login, open the link from Matrix to start logging in", http.StatusBadRequest)
+		return
+	}
+	login := gc.getOAuthLogin(state)
+	if login == nil {
+		http.Error(w, "No matching login is in progress, start the login again from Matrix", http.StatusNotFound)
+		return
+	}
+	select {
+	case login.tokens <- authToken:
+	default:
+		// The login already received a token
+	}
+	http.SetCookie(w, &http.Cookie{Name: oauthLoginCookie, Path: oauthCallbackPath, MaxAge: -1})
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write([]byte("Authorized the bridge, you can close this page and return to Matrix"))
+}
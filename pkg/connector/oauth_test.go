@@ -0,0 +1,96 @@
+package connector
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func newOAuthTestConnector(t *testing.T) (*GroupmeConnector, *GroupmeOAuthLogin) {
+	t.Helper()
+	gc := &GroupmeConnector{Config: Config{OAuth: OAuthConfig{ClientID: "client"}}}
+	login := &GroupmeOAuthLogin{state: "nonce", tokens: make(chan string, 1)}
+	gc.addOAuthLogin(login)
+	return gc, login
+}
+
+func TestOAuthCallbackWithoutState(t *testing.T) {
+	gc, login := newOAuthTestConnector(t)
+
+	start := httptest.NewRecorder()
+	gc.handleOAuthStart(start, httptest.NewRequest(http.MethodGet, oauthStartPath+"?login=nonce", nil))
+	if start.Code != http.StatusFound {
+		t.Fatalf("start responded with %d, want a redirect", start.Code)
+	}
+	location, err := url.Parse(start.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	} else if !strings.HasPrefix(location.String(), oauthAuthorizeURL) || location.Query().Get("client_id") != "client" {
+		t.Errorf("redirected to %s, want the GroupMe authorization page", location)
+	}
+	cookies := start.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != oauthLoginCookie {
+		t.Fatalf("start set cookies %v, want the login cookie", cookies)
+	}
+
+	// GroupMe only appends the access token to the callback URL
+	callback := httptest.NewRequest(http.MethodGet, oauthCallbackPath+"?access_token=token", nil)
+	callback.AddCookie(cookies[0])
+	resp := httptest.NewRecorder()
+	gc.handleOAuthCallback(resp, callback)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("callback responded with %d: %s", resp.Code, resp.Body)
+	}
+	select {
+	case token := <-login.tokens:
+		if token != "token" {
+			t.Errorf("login got token %q, want %q", token, "token")
+		}
+	default:
+		t.Error("login didn't get the token")
+	}
+}
+
+func TestOAuthCallbackWithState(t *testing.T) {
+	gc, login := newOAuthTestConnector(t)
+
+	resp := httptest.NewRecorder()
+	gc.handleOAuthCallback(resp, httptest.NewRequest(http.MethodGet, oauthCallbackPath+"?access_token=token&state=nonce", nil))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("callback responded with %d: %s", resp.Code, resp.Body)
+	} else if len(login.tokens) != 1 {
+		t.Error("login didn't get the token")
+	}
+}
+
+func TestOAuthCallbackRejectsUnknownLogins(t *testing.T) {
+	gc, login := newOAuthTestConnector(t)
+
+	tests := []struct {
+		name   string
+		query  string
+		cookie string
+		code   int
+	}{
+		{"neither state nor cookie", "access_token=token", "", http.StatusBadRequest},
+		{"unknown state", "access_token=token&state=other", "", http.StatusNotFound},
+		{"unknown cookie", "access_token=token", "other", http.StatusNotFound},
+		{"missing token", "state=nonce", "", http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, oauthCallbackPath+"?"+test.query, nil)
+		if test.cookie != "" {
+			req.AddCookie(&http.Cookie{Name: oauthLoginCookie, Value: test.cookie})
+		}
+		resp := httptest.NewRecorder()
+		gc.handleOAuthCallback(resp, req)
+		if resp.Code != test.code {
+			t.Errorf("%s: callback responded with %d, want %d", test.name, resp.Code, test.code)
+		}
+	}
+	if len(login.tokens) != 0 {
+		t.Error("a rejected callback passed its token to the login")
+	}
+}
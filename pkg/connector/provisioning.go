@@ -0,0 +1,66 @@
+package connector
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"go.mau.fi/util/exhttp"
+	"maunium.net/go/mautrix"
+	"maunium.net/go/mautrix/bridgev2/matrix"
+	"maunium.net/go/mautrix/id"
+)
+
+type ReqJoinGroup struct {
+	URL string `json:"url"`
+}
+
+type RespJoinGroup struct {
+	GroupID string    `json:"group_id"`
+	Name    string    `json:"name"`
+	RoomID  id.RoomID `json:"room_id,omitempty"`
+}
+
+// registerProvisioning adds the GroupMe specific endpoints to the provisioning API
+func (gc *GroupmeConnector) registerProvisioning() {
+	matrixConnector, ok := gc.br.Matrix.(*matrix.Connector)
+	if !ok || matrixConnector.Provisioning == nil {
+		return
+	}
+	gc.provisioning = matrixConnector.Provisioning
+	router := gc.provisioning.GetRouter()
+	router.Path("/v3/groupme/join_group").Methods(http.MethodPost, http.MethodOptions).HandlerFunc(gc.postJoinGroup)
+}
+
+func (gc *GroupmeConnector) postJoinGroup(w http.ResponseWriter, r *http.Request) {
+	var req ReqJoinGroup
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		mautrix.MNotJSON.WithMessage("Failed to decode request body").Write(w)
+		return
+	}
+	login := gc.provisioning.GetLoginForRequest(w, r)
+	if login == nil {
+		return
+	}
+	client, ok := login.Client.(*GroupmeClient)
+	if !ok || client.Client == nil {
+		mautrix.RespError{
+			Err:        "GroupMe login isn't connected",
+			ErrCode:    "FI.MAU.NOT_CONNECTED",
+			StatusCode: http.StatusBadRequest,
+		}.Write(w)
+		return
+	}
+	group, portal, err := client.joinGroupByShareURL(r.Context(), req.URL)
+	if err != nil {
+		matrix.RespondWithError(w, err, "Failed to join group")
+		return
+	}
+	resp := &RespJoinGroup{
+		GroupID: group.ID.String(),
+		Name:    group.Name,
+	}
+	if portal != nil {
+		resp.RoomID = portal.MXID
+	}
+	exhttp.WriteJSONResponse(w, http.StatusOK, resp)
+}
@@ -0,0 +1,57 @@
+package connector
+
+import (
+	"context"
+
+	"github.com/GroveJay/matrix-groupme-bridge/pkg/groupmeclient"
+	"github.com/rs/zerolog"
+	"maunium.net/go/mautrix/bridgev2"
+	"maunium.net/go/mautrix/bridgev2/networkid"
+	"maunium.net/go/mautrix/bridgev2/simplevent"
+)
+
+var _ bridgev2.ReadReceiptHandlingNetworkAPI = (*GroupmeClient)(nil)
+
+func (groupmeClient *GroupmeClient) HandleMatrixReadReceipt(ctx context.Context, msg *bridgev2.MatrixReadReceipt) error {
+	groupmeClient.UserLogin.Log.Info().Msgf("GroupmeClient.HandleMatrixReadReceipt: portal %s", msg.Portal.ID)
+	chatID, _, err := ParsePortalId(msg.Portal.ID)
+	if err != nil {
+		return err
+	}
+	message := msg.ExactMessage
+	if message == nil {
+		// The receipt points at something that isn't a bridged message (e.g. a state event),
+		// so mark the last message before it as read instead
+		message, err = groupmeClient.UserLogin.Bridge.DB.Message.GetLastPartAtOrBeforeTime(ctx, msg.Portal.PortalKey, msg.ReadUpTo)
+		if err != nil {
+			return err
+		} else if message == nil {
+			return nil
+		}
+	}
+	_, err = groupmeClient.Client.CreateReadReceipt(ctx, *chatID, groupmeclient.ID(message.ID))
+	return wrapGroupmeError(err)
+}
+
+func (groupmeClient *GroupmeClient) HandleReadReceipt(receipt groupmeclient.ReadReceipt) {
+	groupmeClient.UserLogin.Log.Debug().Msgf("HandleReadReceipt (chatID: %s, messageID: %s, userID: %s)", receipt.ChatID, receipt.MessageID, receipt.UserID)
+	groupmeClient.UserLogin.Bridge.QueueRemoteEvent(groupmeClient.UserLogin, &simplevent.Receipt{
+		EventMeta: simplevent.EventMeta{
+			Type: bridgev2.RemoteEventReadReceipt,
+			// Receipts from our own user come from reading on another device
+			Sender: groupmeClient.eventSender(receipt.UserID),
+			LogContext: func(c zerolog.Context) zerolog.Context {
+				return c.
+					Str("groupmeID", receipt.ChatID.String()).
+					Str("userId", receipt.UserID.String())
+			},
+			PortalKey: networkid.PortalKey{
+				ID:       MakeGroupmePortalId(receipt.ChatID, groupmeClient.UserLogin.UserLogin.ID),
+				Receiver: groupmeClient.UserLogin.ID,
+			},
+			Timestamp: receipt.ReadAt.ToTime(),
+		},
+		LastTarget: networkid.MessageID(receipt.MessageID),
+		ReadUpTo:   receipt.ReadAt.ToTime(),
+	})
+}
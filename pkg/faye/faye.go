@@ -1,7 +1,11 @@
 package faye
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 )
 
 const (
@@ -12,8 +16,16 @@ const (
 var (
 	MANDATORY_CONNECTION_TYPES = []string{LONG_POLLING}
 	registeredTransports       = []Transport{}
+	// How often a client that fell back to long-polling tries to get a websocket again
+	WEBSOCKET_UPGRADE_INTERVAL = 5 * time.Minute
+	// How long the handshake waits for a websocket before falling back, it blocks the event loop
+	// meanwhile, unlike the dials of later upgrade attempts
+	WEBSOCKET_PROBE_TIMEOUT = 5 * time.Second
 )
 
+// ErrUnauthorized is returned when the server rejects the credentials sent by an extension
+var ErrUnauthorized = errors.New("faye server rejected authentication")
+
 // Logger is the interface that faye uses for it's logger
 type Logger interface {
 	Infof(f string, a ...interface{})
@@ -22,6 +34,35 @@ type Logger interface {
 	Warnf(f string, a ...interface{})
 }
 
+// ConnectionEvent is a change in the connection to the server
+type ConnectionEvent int
+
+const (
+	// A handshake with the server started
+	EventConnecting ConnectionEvent = iota
+	// The handshake and connect request succeeded
+	EventConnected
+	// The connection was lost or the server asked for a new handshake, the client can reconnect
+	EventTransientDisconnect
+	// The server advised not to reconnect at all
+	EventDisconnected
+)
+
+func (e ConnectionEvent) String() string {
+	switch e {
+	case EventConnecting:
+		return "connecting"
+	case EventConnected:
+		return "connected"
+	case EventTransientDisconnect:
+		return "transient disconnect"
+	case EventDisconnected:
+		return "disconnected"
+	default:
+		return fmt.Sprintf("ConnectionEvent(%d)", int(e))
+	}
+}
+
 // Extension models a faye extension
 type Extension interface {
 	In(Message)
@@ -31,10 +72,37 @@ type Extension interface {
 // Subscription models a subscription, containing the channel it is subscribed
 // to and the chan object used to push messages through
 type Subscription struct {
-	channel     string
-	msgChan     chan Message
-	polling     bool
-	stopPolling bool
+	channel string
+	msgChan chan Message
+	// The event loop hands messages to forward, which passes them on to msgChan
+	in chan Message
+	// Closed when the channel is unsubscribed
+	stop chan struct{}
+}
+
+// forward passes messages on to msgChan in order, queueing them while the consumer is busy,
+// and closes msgChan once the subscription is stopped or ctx is done
+func (s *Subscription) forward(ctx context.Context) {
+	defer close(s.msgChan)
+	var queue []Message
+	for {
+		var out chan Message
+		var next Message
+		if len(queue) > 0 {
+			out = s.msgChan
+			next = queue[0]
+		}
+		select {
+		case msg := <-s.in:
+			queue = append(queue, msg)
+		case out <- next:
+			queue = queue[1:]
+		case <-s.stop:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
 }
 
 func StackError(callsite string, err error) error {
@@ -46,3 +114,8 @@ func StackError(callsite string, err error) error {
 func RegisterTransports(transports []Transport) {
 	registeredTransports = transports
 }
+
+// isAuthError checks whether a Bayeux error ("code:args:message") is an authentication failure
+func isAuthError(bayeuxError string) bool {
+	return strings.HasPrefix(bayeuxError, "401:") || strings.HasPrefix(bayeuxError, "403:")
+}
@@ -1,12 +1,15 @@
 package faye
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -24,28 +27,76 @@ const (
 	RETRY     = "retry"
 	NONE      = "none"
 
+	// Unlike the other meta channels this one isn't passed to NewFayeClient, the Bayeux protocol fixes it
+	DISCONNECT_CHANNEL = "/meta/disconnect"
+
 	CONNECTION_TIMEOUT_SECONDS = 3.0 * 60
 	WEBSOCKET_POLL_INITERVAL   = 30.0
+	SUBSCRIBE_RETRY_SECONDS    = 1
 	// DEFAULT_RETRY              = 5.0
 	// MAX_REQUEST_SIZE           = 2048
 )
 
-// FayeClient models a faye client
+var (
+	// ErrClosed is returned by calls on a client after Close
+	ErrClosed = errors.New("faye client closed")
+	// ErrReconnectAdvisedAgainst is returned by HandshakeAndConnect once the server advised not to reconnect
+	ErrReconnectAdvisedAgainst = errors.New("faye server advised not to reconnect")
+)
+
+var errNotConnected = errors.New("not connected")
+
+/*
+FayeClient models a faye client.
+
+All of the connection state is owned by a single event loop goroutine, which is started by the
+first call that needs it. The exported methods hand their work to the loop and wait for the result,
+so they are safe to call from any goroutine. Messages from the websocket are read by a separate
+goroutine that passes them to the loop, and every subscription delivers its messages in order
+through its own goroutine, so a slow consumer never blocks the loop.
+*/
 type FayeClient struct {
-	state              int
 	url                string
 	handshakeChannel   string
 	connectChannel     string
 	subscribeChannel   string
 	unsubscribeChannel string
-	subscriptions      []*Subscription
-	transport          Transport
 	log                Logger
-	clientID           string
-	nextHandshake      int64
-	mutex              *sync.RWMutex // protects instance vars across goroutines
 	extns              []Extension
-	message_id         int
+	authFailureHandler func(error)
+	eventHandler       func(ConnectionEvent, error)
+
+	// Mirrors the loop's state so Connected doesn't have to wait for the loop
+	state atomic.Int32
+
+	ctx       context.Context
+	cancel    context.CancelFunc
+	startOnce sync.Once
+	ops       chan func()
+	incoming  chan incoming
+	done      chan struct{}
+
+	// Only touched by the event loop
+	clientID      string
+	subscriptions []*Subscription
+	transport     Transport
+	nextHandshake time.Time
+	message_id    int
+	authFailed    bool
+	// Closed once the server answered /meta/disconnect or the websocket is gone
+	disconnectAnswered chan struct{}
+	// Whether the server offered websockets in the last handshake, and whether a fallback
+	// to long-polling is trying to upgrade to them
+	websocketOffered bool
+	upgrading        bool
+}
+
+// incoming is what the websocket reader or a long-polling connect passes to the event loop,
+// err is set once the connection failed
+type incoming struct {
+	transport Transport
+	msgs      []Message
+	err       error
 }
 
 // NewFayeClient returns a new client for interfacing to a faye server
@@ -56,28 +107,39 @@ func NewFayeClient(
 	subscribeChannel string,
 	unsubscribeChannel string) *FayeClient {
 
+	ctx, cancel := context.WithCancel(context.Background())
 	fayeClient := &FayeClient{
 		url:                url,
 		handshakeChannel:   handshakeChannel,
 		connectChannel:     connectChannel,
 		subscribeChannel:   subscribeChannel,
 		unsubscribeChannel: unsubscribeChannel,
-		state:              UNCONNECTED,
-		mutex:              &sync.RWMutex{},
 		log:                fayeDefaultLogger{},
+		ctx:                ctx,
+		cancel:             cancel,
+		ops:                make(chan func()),
+		incoming:           make(chan incoming),
+		done:               make(chan struct{}),
 		message_id:         1,
 	}
+	fayeClient.state.Store(UNCONNECTED)
 
 	return fayeClient
 }
 
+// shortID shortens a client ID for logging
+func shortID(clientID string) string {
+	runes := []rune(clientID)
+	return string(runes[:min(len(runes), 4)])
+}
+
 // Out spies on outgoing messages and prints them to the log, when the client
 // is added to itself as an extension
 func (faye *FayeClient) Out(msg Message) {
 	switch v := msg.(type) {
 	case msgWrapper:
 		line := "→ "
-		clientID := string([]rune(v.msg.ClientID)[:4])
+		clientID := shortID(v.msg.ClientID)
 		messageID := v.msg.ID
 		switch channel := v.msg.Channel; channel {
 		case "/meta/handshake":
@@ -86,6 +148,10 @@ func (faye *FayeClient) Out(msg Message) {
 			line = line + fmt.Sprintf("[%s] Connect (%s)", clientID, messageID)
 		case "/meta/subscribe":
 			line = line + fmt.Sprintf("[%s] %s Subscribe (%s)", clientID, v.msg.Subscription, messageID)
+		case "/meta/unsubscribe":
+			line = line + fmt.Sprintf("[%s] %s Unsubscribe (%s)", clientID, v.msg.Subscription, messageID)
+		case DISCONNECT_CHANNEL:
+			line = line + fmt.Sprintf("[%s] Disconnect (%s)", clientID, messageID)
 		default:
 			if v.msg.Data["type"] != nil {
 				line = line + fmt.Sprintf("[%s] %s - %s (%s)", clientID, channel, v.msg.Data["type"], messageID)
@@ -108,7 +174,7 @@ func (faye *FayeClient) In(msg Message) {
 	switch v := msg.(type) {
 	case msgWrapper:
 		line := "← "
-		clientID := string([]rune(v.msg.ClientID)[:4])
+		clientID := shortID(v.msg.ClientID)
 		messageID := v.msg.ID
 
 		switch channel := v.msg.Channel; channel {
@@ -118,6 +184,8 @@ func (faye *FayeClient) In(msg Message) {
 			line = line + fmt.Sprintf("[%s] Connect (%s)", clientID, messageID)
 		case "/meta/subscribe":
 			line = line + fmt.Sprintf("[%s] Subscribe - %s (%s)", clientID, v.msg.Subscription, messageID)
+		case "/meta/unsubscribe":
+			line = line + fmt.Sprintf("[%s] Unsubscribe - %s (%s)", clientID, v.msg.Subscription, messageID)
 		default:
 			data_type := v.msg.Data["type"]
 			if data_type != nil {
@@ -143,243 +211,542 @@ func (faye *FayeClient) In(msg Message) {
 }
 
 // SetLogger attaches a Logger to the faye client, and replaces the default
-// logger which just puts to stdout
+// logger which just puts to stdout. Must be called before connecting.
 func (faye *FayeClient) SetLogger(log Logger) {
 	faye.log = log
 }
 
-func (faye *FayeClient) Connected() bool {
-	return faye.state == CONNECTED
+// SetAuthFailureHandler sets the function called once when the server rejects the
+// authentication of the client. The client stops reconnecting after that.
+// Must be called before connecting.
+func (faye *FayeClient) SetAuthFailureHandler(handler func(error)) {
+	faye.authFailureHandler = handler
 }
 
-func (faye *FayeClient) HandshakeAndConnect() error {
-	if err := faye.handshake(); err != nil {
-		return StackError("handshake", err)
-	}
-	if err := faye.connect(); err != nil {
-		return StackError("connect", err)
-	}
-	if faye.transport.connectionType() == WEBSOCKET {
-		go faye.websocketReadPoll()
-	}
-	return nil
+// SetConnectionEventHandler sets the function called when the connection to the server changes.
+// It is called from the event loop, so apart from Connected it must not call back into the client.
+// Must be called before connecting.
+func (faye *FayeClient) SetConnectionEventHandler(handler func(ConnectionEvent, error)) {
+	faye.eventHandler = handler
 }
 
-// AddExtension adds an extension to the Faye Client
+// AddExtension adds an extension to the Faye Client. Must be called before connecting.
 func (faye *FayeClient) AddExtension(extn Extension) {
 	faye.extns = append(faye.extns, extn)
 }
 
-// WaitSubscribe will send a subscribe request and block until the connection was successful
-func (faye *FayeClient) WaitSubscribe(channel string, optionalMsgChan ...chan Message) {
-	msgChan := make(chan Message)
-	if len(optionalMsgChan) > 0 {
-		msgChan = optionalMsgChan[0]
+func (faye *FayeClient) Connected() bool {
+	return faye.state.Load() == CONNECTED
+}
+
+/*//////// Event loop ////////*/
+
+func (faye *FayeClient) start() {
+	faye.startOnce.Do(func() {
+		go faye.run()
+	})
+}
+
+// Disconnect tells the server the client is leaving, waits for its answer until ctx is done, and closes the client, see Close.
+// The client is closed even if the server couldn't be told.
+func (faye *FayeClient) Disconnect(ctx context.Context) error {
+	var answered chan struct{}
+	err := faye.do(ctx, func() error {
+		if faye.state.Load() != CONNECTED {
+			return nil
+		}
+		faye.setState(DISCONNECTED)
+		msg := NewMessage(faye.clientID, DISCONNECT_CHANNEL)
+		if faye.transport.connectionType() == WEBSOCKET {
+			faye.disconnectAnswered = make(chan struct{})
+			answered = faye.disconnectAnswered
+			return faye.sendOnly(msg)
+		}
+		response, _, err := faye.send(msg)
+		if err != nil {
+			return err
+		} else if !response.OK() {
+			return errors.New(response.Error())
+		}
+		return nil
+	})
+	// Closing the websocket right away could drop the request, which is still on its way
+	if err == nil && answered != nil {
+		select {
+		case <-answered:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
 	}
-	subscription := &Subscription{
-		channel:     channel,
-		msgChan:     msgChan,
-		stopPolling: false,
+	faye.Close()
+	if errors.Is(err, ErrClosed) {
+		return nil
 	}
+	return err
+}
+
+func (faye *FayeClient) answerDisconnect() {
+	if faye.disconnectAnswered != nil {
+		close(faye.disconnectAnswered)
+		faye.disconnectAnswered = nil
+	}
+}
+
+// Close stops the event loop and every goroutine of the client, without telling the server.
+// Subscription channels are closed, and calls made after this return ErrClosed.
+func (faye *FayeClient) Close() {
+	faye.cancel()
+	// If the loop never started there is nothing to wait for
+	faye.startOnce.Do(func() {
+		close(faye.done)
+	})
+	<-faye.done
+}
+
+func (faye *FayeClient) run() {
+	defer close(faye.done)
+	pingTicker := time.NewTicker(time.Duration(WEBSOCKET_POLL_INITERVAL) * time.Second)
+	defer pingTicker.Stop()
+	upgradeTicker := time.NewTicker(WEBSOCKET_UPGRADE_INTERVAL)
+	defer upgradeTicker.Stop()
 
 	for {
-		if err := faye.requestSubscription(subscription); err != nil {
-			faye.log.Errorf("requestSubscription error: %s", err)
-			time.Sleep(1 * time.Second)
-			continue
+		select {
+		case <-faye.ctx.Done():
+			if faye.transport != nil {
+				faye.transport.close()
+			}
+			faye.setState(UNCONNECTED)
+			return
+		case op := <-faye.ops:
+			op()
+		case in := <-faye.incoming:
+			faye.handleIncoming(in)
+		case <-pingTicker.C:
+			faye.websocketPing()
+		case <-upgradeTicker.C:
+			faye.tryUpgrade()
 		}
-		faye.log.Debugf("requestSubscription succeeded")
-		break
 	}
+}
 
-	faye.subscriptions = append(faye.subscriptions, subscription)
+// do runs op on the event loop and waits for its result
+func (faye *FayeClient) do(ctx context.Context, op func() error) error {
+	faye.start()
+	result := make(chan error, 1)
+	select {
+	case faye.ops <- func() { result <- op() }:
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-faye.done:
+		return ErrClosed
+	}
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-faye.done:
+		return ErrClosed
+	}
 }
 
-// resubscribe all of the subscriptions
-func (faye *FayeClient) ResubscribeAll() {
-	existingSubscriptions := faye.subscriptions
-	faye.subscriptions = []*Subscription{}
+// sleep waits for d, returning early with an error if the call or the client is cancelled
+func (faye *FayeClient) sleep(ctx context.Context, d time.Duration) error {
+	select {
+	case <-time.After(d):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-faye.done:
+		return ErrClosed
+	}
+}
+
+func (faye *FayeClient) setState(state int) {
+	faye.state.Store(int32(state))
+}
 
-	faye.log.Debugf("Attempting to resubscribe %d existing subscription(s)", len(existingSubscriptions))
-	for _, existingSubscription := range existingSubscriptions {
-		existingSubscription.stopPolling = false
-		// fork off all the resubscribe requests
-		go faye.resubscribe(existingSubscription)
+func (faye *FayeClient) emit(event ConnectionEvent, err error) {
+	if faye.eventHandler != nil {
+		faye.eventHandler(event, err)
 	}
 }
 
-// Publish a message to the given channel
-func (faye *FayeClient) Publish(channel string, data map[string]interface{}) error {
-	msg := NewMessage(faye.clientID, channel)
-	msg.Data = data
-	response, _, err := faye.send(msg)
-	if err != nil {
-		return err
+// failAuth stops the client from reconnecting and reports the failure to the handler
+func (faye *FayeClient) failAuth(bayeuxError string) error {
+	err := fmt.Errorf("%w: %s", ErrUnauthorized, bayeuxError)
+	alreadyFailed := faye.authFailed
+	faye.authFailed = true
+	faye.setState(DISCONNECTED)
+	if !alreadyFailed && faye.authFailureHandler != nil {
+		faye.authFailureHandler(err)
 	}
+	return err
+}
 
-	go faye.handleAdvice(response.Advice())
+/*//////// Connecting ////////*/
 
-	if !response.OK() {
-		return fmt.Errorf("Response was not successful")
+// HandshakeAndConnect makes a single attempt to connect to the server, retrying is up to the caller.
+// If the server advised an interval before the next handshake, it waits for that first.
+func (faye *FayeClient) HandshakeAndConnect(ctx context.Context) error {
+	var wait time.Duration
+	if err := faye.do(ctx, func() error {
+		wait = time.Until(faye.nextHandshake)
+		return nil
+	}); err != nil {
+		return err
 	}
+	if wait > 0 {
+		faye.log.Debugf("Waiting for %s before the next handshake, as advised by the server", wait)
+		if err := faye.sleep(ctx, wait); err != nil {
+			return err
+		}
+	}
+	return faye.do(ctx, faye.handshakeAndConnect)
+}
 
+func (faye *FayeClient) handshakeAndConnect() error {
+	if err := faye.handshake(); err != nil {
+		return err
+	}
+	if err := faye.connect(); err != nil {
+		faye.setState(UNCONNECTED)
+		faye.emit(EventTransientDisconnect, err)
+		return StackError("connect", err)
+	}
+	if faye.transport.connectionType() == WEBSOCKET {
+		go faye.websocketReadPoll(faye.transport)
+	}
+	faye.emit(EventConnected, nil)
+	// The subscriptions belonged to the previous client ID
+	if len(faye.subscriptions) > 0 {
+		faye.resubscribeAll()
+	}
 	return nil
 }
 
-func (faye *FayeClient) websocketReadPoll() {
-	for {
-		if err := faye.websocketRead(); err != nil {
-			faye.log.Debugf("Got error from websocket, breaking: %s", err)
-			break
-		}
+func (faye *FayeClient) handshake() error {
+	if faye.authFailed {
+		return ErrUnauthorized
 	}
-	faye.transport.close()
-	for _, subscription := range faye.subscriptions {
-		// close(subscription.msgChan)
-		subscription.stopPolling = true
+	// uh oh spaghettios!
+	if faye.state.Load() == DISCONNECTED {
+		return ErrReconnectAdvisedAgainst
+	}
+
+	// A new handshake replaces the previous connection, its reader stops once it's closed
+	if faye.transport != nil {
+		faye.transport.close()
+	}
+	t, err := selectTransport(faye.ctx, faye, MANDATORY_CONNECTION_TYPES)
+	if err != nil {
+		return fmt.Errorf("no usable transports available")
+	}
+	faye.transport = t
+	faye.transport.setURL(faye.url)
+	faye.transport.setTimeoutSeconds(CONNECTION_TIMEOUT_SECONDS)
+	faye.setState(CONNECTING)
+	faye.emit(EventConnecting, nil)
+
+	msg := NewMessage(faye.clientID, faye.handshakeChannel)
+	msg.Version = "1.0"
+	msg.SupportedConnectionTypes = []string{LONG_POLLING}
+	response, _, err := faye.send(msg)
+	if err == nil && !response.OK() && isAuthError(response.Error()) {
+		return faye.failAuth(response.Error())
+	}
+	if err == nil && !response.OK() {
+		err = errors.New(response.Error())
+	}
+	if err != nil {
+		faye.setState(UNCONNECTED)
+		faye.emit(EventTransientDisconnect, err)
+		return StackError("handshake", err)
 	}
-	faye.state = UNCONNECTED
-	//faye.clientID = ""
+	faye.log.Debugf("Handshake successful")
+
+	faye.clientID = response.ClientID()
+	faye.setState(CONNECTED)
+	handshakeTransport := faye.transport
+	probeCtx, cancel := context.WithTimeout(faye.ctx, WEBSOCKET_PROBE_TIMEOUT)
+	faye.transport, err = selectTransport(probeCtx, faye, response.SupportedConnectionTypes())
+	cancel()
+	handshakeTransport.close()
+	if err != nil {
+		faye.setState(UNCONNECTED)
+		return fmt.Errorf("Server does not support any available transports. Supported transports: " + strings.Join(response.SupportedConnectionTypes(), ","))
+	}
+	faye.websocketOffered = slices.Contains(response.SupportedConnectionTypes(), WEBSOCKET)
+	if faye.websocketOffered && faye.transport.connectionType() != WEBSOCKET {
+		faye.log.Warnf("Websocket connection failed, falling back to %s", faye.transport.connectionType())
+	}
+	faye.transport.setTimeoutSeconds(CONNECTION_TIMEOUT_SECONDS)
+	faye.handleAdvice(response)
+
+	return nil
 }
 
-func (faye *FayeClient) websocketRead() error {
-	// faye.log.Debugf("Awaiting read from websocket")
-	decoder, err := faye.transport.read()
-	// faye.log.Debugf("Read from websocket")
+// Connects to the server. The response arrives like any other message over websockets, and
+// from a separate goroutine for long-polling, since the server holds it until there is something to deliver.
+func (faye *FayeClient) connect() error {
+	msg := NewMessage(faye.clientID, faye.connectChannel)
+	msg.ConnectionType = faye.transport.connectionType()
+
+	if msg.ConnectionType == WEBSOCKET {
+		return faye.sendOnly(msg)
+	}
+
+	message, err := faye.setupSend(msg)
 	if err != nil {
-		return StackError("transport.read", err)
-	} else {
-		r, m, err := decodeResponse(decoder)
-		if err != nil {
-			return StackError("decodeResponse", err)
-		}
-		/*
-			if r.ClientID() != faye.clientID {
-				// faye.log.Warnf("Ignoring message for channel %s with different clientID %s", r.Channel(), r.ClientID())
-				// faye.requestUnsubscribe(r.Channel(), r.ClientID())
-				return nil
-			}
-		*/
-		go faye.handleAdvice(r.Advice())
-		if len(m) > 0 {
-			// faye.log.Debugf("Got %d messages", len(m))
-			faye.handleMessages(m)
-		}
+		return StackError("setupSend", err)
 	}
-	// faye.log.Debugf("Done reading from websocket")
+	go faye.longPoll(faye.transport, message)
 	return nil
 }
 
-func (faye *FayeClient) websocketPingPoll(subscription *Subscription) {
-	subscription.polling = true
+// longPoll sends a long-polling connect and passes the messages it returns to the event loop
+func (faye *FayeClient) longPoll(transport Transport, message Message) {
+	var msgs []Message
+	dec, err := transport.send(faye.ctx, message)
+	if err != nil {
+		err = StackError("transport.send", err)
+	} else if _, msgs, err = decodeResponse(dec); err != nil {
+		err = StackError("decodeResponse", err)
+	}
+	select {
+	case faye.incoming <- incoming{transport: transport, msgs: msgs, err: err}:
+	case <-faye.ctx.Done():
+	}
+}
+
+// websocketReadPoll passes everything read from the websocket to the event loop until the connection fails
+func (faye *FayeClient) websocketReadPoll(transport Transport) {
 	for {
-		if faye.state != CONNECTED {
-			faye.log.Debugf("Faye was disconnected, stopping websocket ping polling")
-			break
+		var msgs []Message
+		decoder, err := transport.read(faye.ctx)
+		if err != nil {
+			err = StackError("transport.read", err)
+		} else if _, msgs, err = decodeResponse(decoder); err != nil {
+			err = StackError("decodeResponse", err)
 		}
-		if subscription.stopPolling {
-			faye.log.Debugf("Subscription stopPolling true, stopping websocket ping polling")
-			break
+		select {
+		case faye.incoming <- incoming{transport: transport, msgs: msgs, err: err}:
+		case <-faye.ctx.Done():
+			return
 		}
-		if err := faye.websocketPing(subscription.channel); err != nil {
-			faye.log.Errorf("%s", StackError("websocketPing", err))
-			break
+		if err != nil {
+			return
 		}
-		time.Sleep(time.Duration(WEBSOCKET_POLL_INITERVAL) * time.Second)
 	}
-	subscription.polling = false
 }
 
-func (faye *FayeClient) websocketPing(channel string) error {
-	msg := NewMessage(faye.clientID, channel)
-	msg.Data = map[string]any{"type": "ping"}
-	if err := faye.sendOnly(msg); err != nil {
-		return StackError("sendOnly", err)
+func (faye *FayeClient) handleIncoming(in incoming) {
+	// Leftovers from a connection that was already replaced, the messages it received still count
+	if in.transport != faye.transport {
+		for _, message := range in.msgs {
+			if !strings.HasPrefix(message.Channel(), "/meta/") {
+				faye.runExtensions("in", message)
+				faye.deliver(message)
+			}
+		}
+		return
 	}
-	return nil
+	if in.err != nil {
+		faye.log.Debugf("Got error from %s connection, breaking: %s", in.transport.connectionType(), in.err)
+		faye.transport.close()
+		faye.answerDisconnect()
+		if faye.state.Load() == CONNECTED {
+			faye.setState(UNCONNECTED)
+			faye.emit(EventTransientDisconnect, nil)
+		}
+		return
+	}
+	faye.handleMessages(in.msgs)
 }
 
-func (faye *FayeClient) handshake() error {
-	// uh oh spaghettios!
-	if faye.state == DISCONNECTED {
-		return fmt.Errorf("GTFO: Server told us not to reconnect :(")
+// handles messages from the server, both responses to meta requests and messages for subscriptions
+func (faye *FayeClient) handleMessages(msgs []Message) {
+	for _, message := range msgs {
+		faye.runExtensions("in", message)
+		// Over websockets the responses to meta requests arrive with the other messages
+		if strings.HasPrefix(message.Channel(), "/meta/") {
+			if message.Channel() == DISCONNECT_CHANNEL {
+				faye.answerDisconnect()
+				continue
+			}
+			if isAuthError(message.Error()) {
+				faye.failAuth(message.Error())
+				continue
+			}
+			if response, ok := message.(Response); ok {
+				faye.handleAdvice(response)
+			}
+			continue
+		}
+		faye.deliver(message)
 	}
+}
 
-	// check if we need to wait before handshaking again
-	if faye.nextHandshake > time.Now().Unix() {
-		sleepFor := time.Now().Unix() - faye.nextHandshake
+// handles advice from the server
+func (faye *FayeClient) handleAdvice(response Response) {
+	advice := response.Advice()
+	reconnect := advice.Reconnect()
+	// Long-polling only receives anything while a connect is pending, so without advice it goes on as Bayeux defaults to
+	if reconnect == "" && response.Channel() == faye.connectChannel && faye.transport.connectionType() == LONG_POLLING {
+		reconnect = RETRY
+	}
+	if reconnect == "" {
+		return
+	}
+	interval := advice.Interval()
 
-		// wait for the duration the server told us
-		if sleepFor > 0 {
-			faye.log.Debugf("Waiting for", sleepFor, "seconds before next handshake")
-			time.Sleep(time.Duration(sleepFor) * time.Second)
+	switch reconnect {
+	case RETRY:
+		// The server answers a connect once it timed out or, when long-polling, had something to deliver,
+		// and expects the next one after the interval
+		if response.Channel() == faye.connectChannel && faye.state.Load() == CONNECTED {
+			if interval <= 0 {
+				faye.retryConnect(faye.transport)
+				return
+			}
+			transport := faye.transport
+			time.AfterFunc(intervalDuration(interval), func() {
+				_ = faye.do(faye.ctx, func() error {
+					faye.retryConnect(transport)
+					return nil
+				})
+			})
 		}
+	case HANDSHAKE:
+		faye.setState(UNCONNECTED) // force a handshake on the next request
+		if interval > 0 {
+			faye.nextHandshake = time.Now().Add(intervalDuration(interval))
+		}
+		faye.emit(EventTransientDisconnect, nil)
+	case NONE:
+		faye.setState(DISCONNECTED)
+		faye.log.Errorf("GTFO: Server advised not to reconnect :(")
+		faye.emit(EventDisconnected, ErrReconnectAdvisedAgainst)
 	}
+}
 
-	t, err := selectTransport(faye, MANDATORY_CONNECTION_TYPES)
-	if err != nil {
-		return fmt.Errorf("no usable transports available")
+// retryConnect sends the next connect, unless the connection it was advised for was replaced in the meantime
+func (faye *FayeClient) retryConnect(transport Transport) {
+	if transport != faye.transport || faye.state.Load() != CONNECTED {
+		return
 	}
+	if err := faye.connect(); err != nil {
+		faye.log.Errorf("Error connecting while handling advice: %s", StackError("connect", err))
+	}
+}
 
-	faye.mutex.Lock()
-	faye.transport = t
-	faye.transport.setURL(faye.url)
-	faye.state = CONNECTING
-	faye.mutex.Unlock()
-
-	var response Response
-
-	for {
-		msg := NewMessage(faye.clientID, faye.handshakeChannel)
-		msg.Version = "1.0"
-		msg.SupportedConnectionTypes = []string{LONG_POLLING}
-		response, _, err = faye.send(msg)
-
+// tryUpgrade dials a websocket in the background while the client fell back to long-polling
+func (faye *FayeClient) tryUpgrade() {
+	if faye.upgrading || !faye.websocketOffered || faye.state.Load() != CONNECTED || faye.transport.connectionType() == WEBSOCKET {
+		return
+	}
+	faye.upgrading = true
+	go func() {
+		transport, err := selectTransport(faye.ctx, faye, []string{WEBSOCKET})
 		if err != nil {
-			faye.mutex.Lock()
-			faye.state = UNCONNECTED
-			faye.mutex.Unlock()
-
-			faye.log.Warnf("Handshake failed. Retry in 10 seconds")
-			time.Sleep(10 * time.Second)
-			continue
+			faye.log.Debugf("Websocket still unavailable, staying on long-polling")
 		}
-		faye.log.Debugf("Handshake successful")
-		break
+		if err := faye.do(faye.ctx, func() error {
+			faye.upgrading = false
+			if transport != nil {
+				faye.upgrade(transport)
+			}
+			return nil
+		}); err != nil && transport != nil {
+			transport.close()
+		}
+	}()
+}
+
+// upgrade switches the connection over to a websocket, keeping the client ID and its subscriptions
+func (faye *FayeClient) upgrade(transport Transport) {
+	if faye.state.Load() != CONNECTED || faye.transport.connectionType() == WEBSOCKET {
+		transport.close()
+		return
 	}
+	transport.setTimeoutSeconds(CONNECTION_TIMEOUT_SECONDS)
+	longPolling := faye.transport
+	faye.transport = transport
+	if err := faye.connect(); err != nil {
+		faye.log.Warnf("Upgrading to websocket failed, staying on long-polling: %s", err)
+		transport.close()
+		faye.transport = longPolling
+		return
+	}
+	// The pending long-polling connect is answered by the server eventually, and ignored then
+	longPolling.close()
+	go faye.websocketReadPoll(transport)
+	faye.log.Infof("Upgraded from long-polling to websocket")
+}
 
-	faye.mutex.Lock()
-	oldClientID := faye.clientID
-	faye.clientID = response.ClientID()
-	faye.state = CONNECTED
-	faye.transport, err = selectTransport(faye, response.SupportedConnectionTypes())
-	faye.transport.setTimeoutSeconds(CONNECTION_TIMEOUT_SECONDS)
-	faye.mutex.Unlock()
+// intervalDuration converts an advice interval, which Bayeux gives in milliseconds
+func intervalDuration(interval float64) time.Duration {
+	return time.Duration(interval * float64(time.Millisecond))
+}
 
-	if err != nil {
-		return fmt.Errorf("Server does not support any available transports. Supported transports: " + strings.Join(response.SupportedConnectionTypes(), ","))
+/*//////// Subscriptions ////////*/
+
+// WaitSubscribe will send a subscribe request and block until the connection was successful,
+// the server rejected the authentication of the client, or ctx is done.
+// Messages are delivered to the channel in order, and it's closed when the client is closed.
+func (faye *FayeClient) WaitSubscribe(ctx context.Context, channel string, optionalMsgChan ...chan Message) error {
+	msgChan := make(chan Message)
+	if len(optionalMsgChan) > 0 {
+		msgChan = optionalMsgChan[0]
+	}
+	subscription := &Subscription{
+		channel: channel,
+		msgChan: msgChan,
+		in:      make(chan Message),
+		stop:    make(chan struct{}),
 	}
 
-	if oldClientID != faye.clientID && len(faye.subscriptions) > 0 {
-		faye.log.Warnf("Client ID changed (%s => %s), %d invalid subscriptions", oldClientID, faye.clientID, len(faye.subscriptions))
-		faye.ResubscribeAll()
+	for {
+		err := faye.do(ctx, func() error {
+			return faye.subscribe(subscription)
+		})
+		if err == nil {
+			faye.log.Debugf("requestSubscription succeeded")
+			return nil
+		} else if errors.Is(err, ErrUnauthorized) || errors.Is(err, ErrClosed) || ctx.Err() != nil {
+			return err
+		}
+		faye.log.Errorf("requestSubscription error: %s", err)
+		if err := faye.sleep(ctx, SUBSCRIBE_RETRY_SECONDS*time.Second); err != nil {
+			return err
+		}
 	}
+}
 
+func (faye *FayeClient) subscribe(subscription *Subscription) error {
+	if faye.authFailed {
+		return ErrUnauthorized
+	} else if faye.state.Load() != CONNECTED {
+		return errNotConnected
+	}
+	if err := faye.requestSubscription(subscription); err != nil {
+		return err
+	}
+	faye.subscriptions = append(faye.subscriptions, subscription)
+	go subscription.forward(faye.ctx)
 	return nil
 }
 
-func (faye *FayeClient) resubscribe(subscription *Subscription) {
-	for {
+// resubscribe all of the subscriptions
+func (faye *FayeClient) resubscribeAll() {
+	faye.log.Debugf("Attempting to resubscribe %d existing subscription(s)", len(faye.subscriptions))
+	for _, subscription := range faye.subscriptions {
 		if err := faye.requestSubscription(subscription); err != nil {
-			time.Sleep(1 * time.Second)
+			faye.log.Errorf("Failed to resubscribe to %s: %s", subscription.channel, err)
 			continue
 		}
-		// if it worked add it back to the list
-		faye.mutex.Lock()
-		defer faye.mutex.Unlock()
-		faye.subscriptions = append(faye.subscriptions, subscription)
 		faye.log.Debugf("Resubscribed to %s", subscription.channel)
-		return
 	}
 }
 
@@ -392,12 +759,6 @@ func (faye *FayeClient) requestSubscription(subscription *Subscription) error {
 		if err := faye.sendOnly(msg); err != nil {
 			return StackError("sendOnly", err)
 		}
-		if !subscription.polling {
-			faye.log.Debugf("Starting subscription polling for %s", subscription.channel)
-			go faye.websocketPingPoll(subscription)
-		} else {
-			faye.log.Debugf("Skipping subscription polling for %s", subscription.channel)
-		}
 		return nil
 	}
 	// TODO: check if the protocol allows a subscribe during an active connect request
@@ -406,13 +767,16 @@ func (faye *FayeClient) requestSubscription(subscription *Subscription) error {
 		return err
 	}
 
-	go faye.handleAdvice(response.Advice())
+	faye.handleAdvice(response)
 
 	if !response.OK() {
 		// TODO: put more information in the error message about why it failed
 		errmsg := "Response was unsuccessful: "
 
 		if response.HasError() {
+			if isAuthError(response.Error()) {
+				return faye.failAuth(response.Error())
+			}
 			errmsg += " / " + response.Error()
 		}
 		reserr := errors.New(errmsg)
@@ -422,19 +786,47 @@ func (faye *FayeClient) requestSubscription(subscription *Subscription) error {
 	return nil
 }
 
-/*
-func (faye *FayeClient) requestUnsubscribe(channel string, clientId string) error {
-	if err := faye.connectIfNotConnected(); err != nil {
-		return err
+// Unsubscribe tells the server to stop sending messages for the channel and closes the
+// subscription's message channel. Unsubscribing from a channel that isn't subscribed is a no-op.
+// The subscription is dropped even if the request fails, a new handshake won't restore it.
+func (faye *FayeClient) Unsubscribe(ctx context.Context, channel string) error {
+	return faye.do(ctx, func() error {
+		if !faye.removeSubscription(channel) {
+			return nil
+		}
+		// The server forgets about subscriptions of a client that has to handshake again
+		if faye.state.Load() != CONNECTED {
+			return nil
+		}
+		return faye.requestUnsubscribe(channel)
+	})
+}
+
+// removeSubscription stops the subscriptions of a channel and returns whether there were any
+func (faye *FayeClient) removeSubscription(channel string) bool {
+	removed := false
+	subscriptions := faye.subscriptions[:0]
+	for _, subscription := range faye.subscriptions {
+		if subscription.channel == channel {
+			close(subscription.stop)
+			removed = true
+			continue
+		}
+		subscriptions = append(subscriptions, subscription)
 	}
+	clear(faye.subscriptions[len(subscriptions):])
+	faye.subscriptions = subscriptions
+	return removed
+}
 
+// requests the server to drop a subscription and returns error if the request failed
+func (faye *FayeClient) requestUnsubscribe(channel string) error {
 	msg := NewMessage(faye.clientID, faye.unsubscribeChannel)
-	msg.ClientID = clientId
 	msg.Subscription = channel
 
 	if faye.transport.connectionType() == WEBSOCKET {
 		if err := faye.sendOnly(msg); err != nil {
-			return err
+			return StackError("sendOnly", err)
 		}
 		return nil
 	}
@@ -444,88 +836,83 @@ func (faye *FayeClient) requestUnsubscribe(channel string, clientId string) erro
 		return err
 	}
 
-	go faye.handleAdvice(response.Advice())
+	faye.handleAdvice(response)
 
 	if !response.OK() {
-		// TODO: put more information in the error message about why it failed
 		errmsg := "Response was unsuccessful: "
 
 		if response.HasError() {
+			if isAuthError(response.Error()) {
+				return faye.failAuth(response.Error())
+			}
 			errmsg += " / " + response.Error()
 		}
-		reserr := errors.New(errmsg)
-		return reserr
+		return errors.New(errmsg)
 	}
 	return nil
 }
-*/
 
-// handles a response from the server
-func (faye *FayeClient) handleMessages(msgs []Message) {
-	for _, message := range msgs {
-		faye.runExtensions("in", message)
-		for _, subscription := range faye.subscriptions {
-			matched, _ := filepath.Match(subscription.channel, message.Channel())
-			if matched {
-				go func() { subscription.msgChan <- message }()
-				return
+// deliver passes a message to the subscription of its channel
+func (faye *FayeClient) deliver(message Message) {
+	for _, subscription := range faye.subscriptions {
+		matched, _ := filepath.Match(subscription.channel, message.Channel())
+		if matched {
+			select {
+			case subscription.in <- message:
+			case <-subscription.stop:
+			case <-faye.ctx.Done():
 			}
+			return
 		}
-		faye.log.Warnf("Unable to find subscription for channel %s", message.Channel())
 	}
+	faye.log.Warnf("Unable to find subscription for channel %s", message.Channel())
 }
 
-// handles advice from the server
-func (faye *FayeClient) handleAdvice(advice Advice) {
-	faye.mutex.Lock()
-	defer faye.mutex.Unlock()
-
-	if advice.Reconnect() != "" {
-		interval := advice.Interval()
-
-		switch advice.Reconnect() {
-		case RETRY:
-			if err := faye.connect(); err != nil {
-				faye.log.Errorf("Error connecting while handling advice: %s", StackError("connect", err))
-			}
-		case HANDSHAKE:
-			faye.state = UNCONNECTED // force a handshake on the next request
-			if interval > 0 {
-				faye.nextHandshake = int64(time.Duration(time.Now().Unix()) + (time.Duration(interval) * time.Millisecond))
-			}
-		case NONE:
-			faye.state = DISCONNECTED
-			faye.log.Errorf("GTFO: Server advised not to reconnect :(")
+// websocketPing keeps the subscriptions alive, the server drops subscriptions that don't ping
+func (faye *FayeClient) websocketPing() {
+	if faye.state.Load() != CONNECTED || faye.transport == nil || faye.transport.connectionType() != WEBSOCKET {
+		return
+	}
+	for _, subscription := range faye.subscriptions {
+		msg := NewMessage(faye.clientID, subscription.channel)
+		msg.Data = map[string]any{"type": "ping"}
+		if err := faye.sendOnly(msg); err != nil {
+			faye.log.Errorf("%s", StackError("websocketPing", StackError("sendOnly", err)))
+			return
 		}
 	}
 }
 
-// Connects to the server. Waits for a response if HTTPTransport
-func (faye *FayeClient) connect() error {
-	msg := NewMessage(faye.clientID, faye.connectChannel)
-	msg.ConnectionType = faye.transport.connectionType()
+/*//////// Publishing ////////*/
 
-	if msg.ConnectionType == WEBSOCKET {
-		return faye.sendOnly(msg)
-	}
+// Publish a message to the given channel
+func (faye *FayeClient) Publish(ctx context.Context, channel string, data map[string]interface{}) error {
+	return faye.do(ctx, func() error {
+		if faye.state.Load() != CONNECTED {
+			return errNotConnected
+		}
+		msg := NewMessage(faye.clientID, channel)
+		msg.Data = data
+		if faye.transport.connectionType() == WEBSOCKET {
+			return faye.sendOnly(msg)
+		}
+		response, _, err := faye.send(msg)
+		if err != nil {
+			return err
+		}
 
-	response, messages, err := faye.send(msg)
-	if err != nil {
-		faye.log.Errorf("Error while sending connect request: %s", err)
-		return err
-	}
+		faye.handleAdvice(response)
 
-	go faye.handleAdvice(response.Advice())
+		if !response.OK() {
+			return fmt.Errorf("Response was not successful")
+		}
 
-	if response.OK() {
-		go faye.handleMessages(messages)
-	} else {
-		faye.log.Errorf("Error in response to connect request: %s", response.Error())
-		return errors.New(response.Error())
-	}
-	return nil
+		return nil
+	})
 }
 
+/*//////// Sending ////////*/
+
 func (faye *FayeClient) setupSend(msg *message) (Message, error) {
 	if msg.ClientID == "" && msg.Channel != faye.handshakeChannel && faye.clientID != "" {
 		msg.ClientID = faye.clientID
@@ -549,7 +936,7 @@ func (faye *FayeClient) send(msg *message) (Response, []Message, error) {
 		return nil, []Message{}, err // Message has Error() so can be returned as an error
 	}
 
-	dec, err := faye.transport.send(message)
+	dec, err := faye.transport.send(faye.ctx, message)
 	if err != nil {
 		err = StackError("transport.send", err)
 		faye.log.Errorf("%s", err)
@@ -559,20 +946,19 @@ func (faye *FayeClient) send(msg *message) (Response, []Message, error) {
 	r, m, err := decodeResponse(dec)
 	if err != nil {
 		faye.log.Errorf("Failed to decode response: %s", err)
+		return nil, []Message{}, err
 	}
 
-	if r != nil {
-		faye.runExtensions("in", r.(Message))
-	}
+	faye.runExtensions("in", r.(Message))
 
-	return r, m, err
+	return r, m, nil
 }
 
 func (faye *FayeClient) sendOnly(msg *message) error {
 	if message, err := faye.setupSend(msg); err != nil {
 		return StackError("setupSend", err)
 	} else {
-		if err = faye.transport.sendOnly(message); err != nil {
+		if err = faye.transport.sendOnly(faye.ctx, message); err != nil {
 			return StackError("transport.sendOnly", err)
 		}
 	}
@@ -0,0 +1,222 @@
+package faye_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/GroveJay/matrix-groupme-bridge/pkg/faye"
+	"github.com/GroveJay/matrix-groupme-bridge/pkg/groupmeclient"
+	"github.com/GroveJay/matrix-groupme-bridge/pkg/groupmetest"
+)
+
+const testToken = "token"
+
+type quietLogger struct{}
+
+func (quietLogger) Infof(f string, a ...interface{})  {}
+func (quietLogger) Errorf(f string, a ...interface{}) {}
+func (quietLogger) Debugf(f string, a ...interface{}) {}
+func (quietLogger) Warnf(f string, a ...interface{})  {}
+
+// tokenExt authenticates subscriptions the way GroupMe expects
+type tokenExt struct{}
+
+func (tokenExt) In(faye.Message) {}
+
+func (tokenExt) Out(msg faye.Message) {
+	if msg.Channel() == "/meta/subscribe" {
+		msg.Ext()["access_token"] = testToken
+	}
+}
+
+func newTestClient(t *testing.T) (*faye.FayeClient, *groupmetest.Server) {
+	t.Helper()
+	server := groupmetest.NewServer(testToken, &groupmeclient.User{ID: "1", Name: "Me"})
+	t.Cleanup(server.Close)
+	faye.RegisterTransports([]faye.Transport{
+		&faye.WebsocketTransport{},
+		&faye.HTTPTransport{},
+	})
+	client := faye.NewFayeClient(server.PushServer(), "/meta/handshake", "/meta/connect", "/meta/subscribe", "/meta/unsubscribe")
+	client.SetLogger(quietLogger{})
+	client.AddExtension(tokenExt{})
+	t.Cleanup(client.Close)
+	return client, server
+}
+
+// waitForMessage pushes to the channel until the client receives it, pushes can race a resubscription
+func waitForMessage(ctx context.Context, t *testing.T, server *groupmetest.Server, channel string, messages chan faye.Message) {
+	t.Helper()
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		server.Push(channel, map[string]any{"type": "test"})
+		select {
+		case msg := <-messages:
+			if msg.Channel() != channel {
+				t.Errorf("got message on %s, want %s", msg.Channel(), channel)
+			}
+			return
+		case <-ticker.C:
+		case <-ctx.Done():
+			t.Fatalf("no message received on %s", channel)
+		}
+	}
+}
+
+func TestConcurrentSubscribePublishReconnect(t *testing.T) {
+	client, server := newTestClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	if err := client.HandshakeAndConnect(ctx); err != nil {
+		t.Fatal(err)
+	} else if !client.Connected() {
+		t.Fatal("Connected() = false after HandshakeAndConnect")
+	}
+
+	channels := []string{"/user/1", "/group/10", "/group/11", "/direct_message/1_2"}
+	messages := make([]chan faye.Message, len(channels))
+	var wg sync.WaitGroup
+	for i, channel := range channels {
+		messages[i] = make(chan faye.Message)
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if err := client.WaitSubscribe(ctx, channel, messages[i]); err != nil {
+				t.Errorf("WaitSubscribe(%s) = %v", channel, err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for range 5 {
+				if err := client.Publish(ctx, channel, map[string]any{"type": "ping"}); err != nil {
+					t.Errorf("Publish(%s) = %v", channel, err)
+				}
+				client.Connected()
+			}
+		}()
+	}
+	wg.Wait()
+	for i, channel := range channels {
+		if err := server.WaitForSubscription(ctx, channel); err != nil {
+			t.Fatal(err)
+		}
+		waitForMessage(ctx, t, server, channel, messages[i])
+	}
+
+	// Reconnect while other calls are using the client
+	server.DropPushConnections()
+	for client.Connected() {
+		select {
+		case <-time.After(10 * time.Millisecond):
+		case <-ctx.Done():
+			t.Fatal("client didn't notice the dropped connection")
+		}
+	}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		if err := client.HandshakeAndConnect(ctx); err != nil {
+			t.Errorf("HandshakeAndConnect() = %v", err)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		// Waits for the reconnect, subscribing is retried until the client is connected
+		if err := client.WaitSubscribe(ctx, "/group/12"); err != nil {
+			t.Errorf("WaitSubscribe() while reconnecting = %v", err)
+		}
+	}()
+	wg.Wait()
+	for i, channel := range channels {
+		waitForMessage(ctx, t, server, channel, messages[i])
+	}
+
+	client.Close()
+	for i, channel := range channels {
+		if _, ok := <-messages[i]; ok {
+			t.Errorf("channel of %s still open after Close", channel)
+		}
+	}
+	if err := client.Publish(ctx, "/user/1", nil); err != faye.ErrClosed {
+		t.Errorf("Publish() after Close = %v, want ErrClosed", err)
+	}
+}
+
+func TestUnsubscribe(t *testing.T) {
+	client, server := newTestClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := client.HandshakeAndConnect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	messages := make(chan faye.Message)
+	if err := client.WaitSubscribe(ctx, "/group/10", messages); err != nil {
+		t.Fatal(err)
+	} else if err := server.WaitForSubscription(ctx, "/group/10"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.Unsubscribe(ctx, "/group/10"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case _, ok := <-messages:
+		if ok {
+			t.Error("got a message after Unsubscribe, want the channel closed")
+		}
+	case <-ctx.Done():
+		t.Fatal("channel not closed after Unsubscribe")
+	}
+	for server.Subscribed("/group/10") {
+		select {
+		case <-time.After(10 * time.Millisecond):
+		case <-ctx.Done():
+			t.Fatal("server still has the subscription after Unsubscribe")
+		}
+	}
+	if err := client.Unsubscribe(ctx, "/group/10"); err != nil {
+		t.Errorf("Unsubscribe() of a channel that isn't subscribed = %v, want nil", err)
+	}
+}
+
+func TestLongPollingFallback(t *testing.T) {
+	upgradeInterval := faye.WEBSOCKET_UPGRADE_INTERVAL
+	faye.WEBSOCKET_UPGRADE_INTERVAL = 100 * time.Millisecond
+	defer func() {
+		faye.WEBSOCKET_UPGRADE_INTERVAL = upgradeInterval
+	}()
+	client, server := newTestClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	server.BlockPushWebsockets(true)
+	if err := client.HandshakeAndConnect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	messages := make(chan faye.Message)
+	if err := client.WaitSubscribe(ctx, "/user/1", messages); err != nil {
+		t.Fatal(err)
+	} else if err := server.WaitForSubscription(ctx, "/user/1"); err != nil {
+		t.Fatal(err)
+	}
+	waitForMessage(ctx, t, server, "/user/1", messages)
+	if err := client.Publish(ctx, "/user/1", map[string]any{"type": "ping"}); err != nil {
+		t.Errorf("Publish() over long-polling = %v", err)
+	}
+
+	// Once websockets work again the client upgrades, so dropping the websockets disconnects it
+	server.BlockPushWebsockets(false)
+	for client.Connected() {
+		server.DropPushConnections()
+		select {
+		case <-time.After(10 * time.Millisecond):
+		case <-ctx.Done():
+			t.Fatal("client never upgraded to websocket")
+		}
+	}
+}
@@ -2,50 +2,87 @@ package faye
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"io"
 	"net/http"
 	"net/url"
+	"strings"
+	"time"
 )
 
 // HTTPTransport models a faye protocol transport over HTTP long polling
 type HTTPTransport struct {
-	url string
+	url             string
+	timeoutDuration time.Duration
+	// Every transport has its own connections, so closing it doesn't leave idle ones behind
+	client *http.Client
 }
 
-func (t HTTPTransport) isUsable(clientURL string) bool {
-	_, err := url.Parse("https://" + clientURL)
+func (t *HTTPTransport) isUsable(ctx context.Context, clientURL string) bool {
+	t.setURL(clientURL)
+	_, err := url.Parse(t.url)
 	return err == nil
 }
 
-func (t HTTPTransport) connectionType() string {
+// httpURL defaults to https for server URLs without a scheme
+func httpURL(clientURL string) string {
+	if strings.HasPrefix(clientURL, "http://") || strings.HasPrefix(clientURL, "https://") {
+		return clientURL
+	}
+	return "https://" + clientURL
+}
+
+func (t *HTTPTransport) connectionType() string {
 	return "long-polling"
 }
 
-func (t HTTPTransport) close() {
+func (t *HTTPTransport) close() {
+	if t.client != nil {
+		t.client.CloseIdleConnections()
+	}
+}
+
+func (t *HTTPTransport) clone() Transport {
+	return &HTTPTransport{
+		client: &http.Client{Transport: http.DefaultTransport.(*http.Transport).Clone()},
+	}
 }
 
-func (t HTTPTransport) sendOnly(msg json.Marshaler) error {
-	panic("not implemented!")
+func (t *HTTPTransport) sendOnly(ctx context.Context, msg json.Marshaler) error {
+	return errors.New("long-polling can only send requests that wait for a response")
 }
 
-func (t HTTPTransport) send(msg json.Marshaler) (decoder, error) {
+func (t *HTTPTransport) send(ctx context.Context, msg json.Marshaler) (decoder, error) {
 	b, err := json.Marshal(msg)
 
 	if err != nil {
 		return nil, err
 	}
 
-	buffer := bytes.NewBuffer(b)
-	responseData, err := http.Post(t.url, "application/json", buffer)
+	if t.timeoutDuration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.timeoutDuration)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewBuffer(b))
 	if err != nil {
 		return nil, err
 	}
+	req.Header.Set("Content-Type", "application/json")
+	client := t.client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	responseData, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer responseData.Body.Close()
 	if responseData.StatusCode != 200 {
 		return nil, errors.New(responseData.Status)
 	}
-	defer responseData.Body.Close()
 	jsonData, err := io.ReadAll(responseData.Body)
 	if err != nil {
 		return nil, err
@@ -53,14 +90,14 @@ func (t HTTPTransport) send(msg json.Marshaler) (decoder, error) {
 	return json.NewDecoder(bytes.NewBuffer(jsonData)), nil
 }
 
-func (t HTTPTransport) read() (decoder, error) {
-	panic("not implemented!")
+func (t *HTTPTransport) read(ctx context.Context) (decoder, error) {
+	return nil, errors.New("long-polling has no connection to read from")
 }
 
 func (t *HTTPTransport) setURL(url string) {
-	t.url = "https://" + url
+	t.url = httpURL(url)
 }
 
-func (t *HTTPTransport) setTimeoutSeconds(timeout int64) {
-
+func (t *HTTPTransport) setTimeoutSeconds(timeoutSeconds int64) {
+	t.timeoutDuration = time.Second * time.Duration(timeoutSeconds)
 }
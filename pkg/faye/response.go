@@ -3,6 +3,7 @@ package faye
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 )
 
 // Message models a message sent over Faye
@@ -110,6 +111,9 @@ func decodeResponse(dec decoder) (Response, []Message, error) {
 	if err := dec.Decode(&raw); err != nil {
 		return nil, msgs, err
 	}
+	if len(raw) == 0 {
+		return nil, msgs, errors.New("empty response")
+	}
 
 	for _, msg := range raw {
 		msgs = append(msgs, Message(msgWrapper{msg}))
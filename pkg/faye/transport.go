@@ -1,6 +1,7 @@
 package faye
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"slices"
@@ -12,19 +13,25 @@ type decoder interface {
 
 // Transport models a faye protocol transport
 type Transport interface {
-	isUsable(string) bool
+	isUsable(context.Context, string) bool
 	connectionType() string
 	close()
-	send(json.Marshaler) (decoder, error)
-	sendOnly(json.Marshaler) error
-	read() (decoder, error)
+	send(context.Context, json.Marshaler) (decoder, error)
+	sendOnly(context.Context, json.Marshaler) error
+	read(context.Context) (decoder, error)
 	setURL(string)
 	setTimeoutSeconds(int64)
+	// clone returns a new, unconnected transport of the same type, so clients don't share connections
+	clone() Transport
 }
 
-func selectTransport(client *FayeClient, transportTypes []string) (Transport, error) {
-	for _, transport := range registeredTransports {
-		if slices.Contains(transportTypes, transport.connectionType()) && transport.isUsable(client.url) {
+func selectTransport(ctx context.Context, client *FayeClient, transportTypes []string) (Transport, error) {
+	for _, registered := range registeredTransports {
+		if !slices.Contains(transportTypes, registered.connectionType()) {
+			continue
+		}
+		transport := registered.clone()
+		if transport.isUsable(ctx, client.url) {
 			return transport, nil
 		}
 	}
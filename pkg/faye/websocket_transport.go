@@ -4,9 +4,11 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"log"
 
 	"io"
+	"strings"
 	"time"
 
 	"github.com/coder/websocket"
@@ -19,7 +21,7 @@ type WebsocketTransport struct {
 	timeoutDuration time.Duration
 }
 
-func (wt *WebsocketTransport) isUsable(clientURL string) bool {
+func (wt *WebsocketTransport) isUsable(ctx context.Context, clientURL string) bool {
 	wt.setURL(clientURL)
 	if wt.connection != nil {
 		if err := wt.connection.CloseNow(); err != nil {
@@ -27,7 +29,7 @@ func (wt *WebsocketTransport) isUsable(clientURL string) bool {
 		}
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
 	defer cancel()
 	c, _, err := websocket.Dial(ctx, wt.url, nil)
 	if err != nil {
@@ -37,16 +39,25 @@ func (wt *WebsocketTransport) isUsable(clientURL string) bool {
 	return true
 }
 
-func (wt WebsocketTransport) close() {
-	defer wt.connection.CloseNow()
+func (wt *WebsocketTransport) close() {
+	if wt.connection != nil {
+		wt.connection.CloseNow()
+	}
 }
 
-func (wt WebsocketTransport) connectionType() string {
+func (wt *WebsocketTransport) connectionType() string {
 	return "websocket"
 }
 
-func (wt WebsocketTransport) sendOnly(msg json.Marshaler) error {
-	ctx, cancel := context.WithTimeout(context.Background(), wt.timeoutDuration)
+func (wt *WebsocketTransport) clone() Transport {
+	return &WebsocketTransport{}
+}
+
+func (wt *WebsocketTransport) sendOnly(ctx context.Context, msg json.Marshaler) error {
+	if wt.connection == nil {
+		return errors.New("websocket is not connected")
+	}
+	ctx, cancel := context.WithTimeout(ctx, wt.timeoutDuration)
 	defer cancel()
 
 	if err := wsjson.Write(ctx, wt.connection, msg); err != nil {
@@ -55,27 +66,18 @@ func (wt WebsocketTransport) sendOnly(msg json.Marshaler) error {
 	return nil
 }
 
-func (wt WebsocketTransport) send(msg json.Marshaler) (decoder, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), wt.timeoutDuration)
-	defer cancel()
-
-	err := wsjson.Write(ctx, wt.connection, msg)
-	if err != nil {
+func (wt *WebsocketTransport) send(ctx context.Context, msg json.Marshaler) (decoder, error) {
+	if err := wt.sendOnly(ctx, msg); err != nil {
 		return nil, err
 	}
-	_, r, err := wt.connection.Reader(ctx)
-	if err != nil {
-		return nil, err
-	}
-	jsonData, err := io.ReadAll(r)
-	if err != nil {
-		return nil, err
-	}
-	return json.NewDecoder(bytes.NewBuffer(jsonData)), nil
+	return wt.read(ctx)
 }
 
-func (wt WebsocketTransport) read() (decoder, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), wt.timeoutDuration)
+func (wt *WebsocketTransport) read(ctx context.Context) (decoder, error) {
+	if wt.connection == nil {
+		return nil, errors.New("websocket is not connected")
+	}
+	ctx, cancel := context.WithTimeout(ctx, wt.timeoutDuration)
 	defer cancel()
 
 	_, r, err := wt.connection.Reader(ctx)
@@ -89,8 +91,16 @@ func (wt WebsocketTransport) read() (decoder, error) {
 	return json.NewDecoder(bytes.NewBuffer(jsonData)), nil
 }
 
+// setURL accepts the server URL with or without an http(s) scheme
 func (wt *WebsocketTransport) setURL(url string) {
-	wt.url = "ws://" + url
+	switch {
+	case strings.HasPrefix(url, "https://"):
+		wt.url = "wss://" + strings.TrimPrefix(url, "https://")
+	case strings.HasPrefix(url, "http://"):
+		wt.url = "ws://" + strings.TrimPrefix(url, "http://")
+	default:
+		wt.url = "ws://" + url
+	}
 }
 
 func (wt *WebsocketTransport) setTimeoutSeconds(timeoutSeconds int64) {
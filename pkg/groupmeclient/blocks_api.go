@@ -0,0 +1,156 @@
+// Package groupme defines a client capable of executing API commands for the GroupMe chat service
+package groupmeclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// GroupMe documentation: https://dev.groupme.com/docs/v3#blocks
+
+/*//////// Endpoints ////////*/
+const (
+	// Used to build other endpoints
+	blocksEndpointRoot = "/blocks"
+
+	// Actual Endpoints
+	indexBlocksEndpoint  = blocksEndpointRoot              // GET
+	blockBetweenEndpoint = blocksEndpointRoot + "/between" // GET
+	createBlockEndpoint  = blocksEndpointRoot              // POST
+	unblockEndpoint      = blocksEndpointRoot              // DELETE
+)
+
+/*//////// API Requests ////////*/
+
+/*/// Index ///*/
+
+/*
+IndexBlock -
+
+A list of contacts you have blocked. These people cannot DM you
+
+Parameters:
+
+	userID - required, ID(string)
+*/
+func (c *Client) IndexBlock(ctx context.Context, userID ID) ([]*Block, error) {
+	httpReq, err := http.NewRequest("GET", c.endpointBase+indexBlocksEndpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	URL := httpReq.URL
+	query := URL.Query()
+	query.Set("user", userID.String())
+	URL.RawQuery = query.Encode()
+
+	var resp struct {
+		Blocks []*Block `json:"blocks"`
+	}
+	err = c.doWithAuthToken(ctx, httpReq, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Blocks, nil
+}
+
+/*/// Between ///*/
+
+/*
+BlockBetween -
+
+Asks if a block exists between you and another user id.
+
+Parameters:
+
+	userID - required, ID(string)
+	otherUserID - required, ID(string)
+*/
+func (c *Client) BlockBetween(ctx context.Context, userID, otherUserID ID) (bool, error) {
+	httpReq, err := http.NewRequest("GET", c.endpointBase+blockBetweenEndpoint, nil)
+	if err != nil {
+		return false, err
+	}
+
+	URL := httpReq.URL
+	query := URL.Query()
+	query.Set("user", userID.String())
+	query.Set("otherUser", otherUserID.String())
+	URL.RawQuery = query.Encode()
+
+	var resp struct {
+		Between bool `json:"between"`
+	}
+	err = c.doWithAuthToken(ctx, httpReq, &resp)
+	if err != nil {
+		return false, err
+	}
+
+	return resp.Between, nil
+}
+
+/*/// Create ///*/
+
+/*
+CreateBlock -
+
+Creates a block between you and the contact.
+
+Parameters:
+
+	userID - required, ID(string)
+	otherUserID - required, ID(string)
+*/
+func (c *Client) CreateBlock(ctx context.Context, userID, otherUserID ID) (*Block, error) {
+	URL := fmt.Sprintf(c.endpointBase + createBlockEndpoint)
+
+	httpReq, err := http.NewRequest("POST", URL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	query := httpReq.URL.Query()
+	query.Set("user", userID.String())
+	query.Set("otherUser", otherUserID.String())
+	httpReq.URL.RawQuery = query.Encode()
+
+	var resp struct {
+		*Block `json:"block"`
+	}
+	err = c.doWithAuthToken(ctx, httpReq, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Block, nil
+}
+
+/*/// Unblock ///*/
+
+/*
+Unblock -
+
+Removes block between you and other user.
+
+Parameters:
+
+	userID - required, ID(string)
+	otherUserID - required, ID(string)
+*/
+func (c *Client) Unblock(ctx context.Context, userID, otherUserID ID) error {
+	URL := fmt.Sprintf(c.endpointBase + unblockEndpoint)
+
+	httpReq, err := http.NewRequest("DELETE", URL, nil)
+	if err != nil {
+		return err
+	}
+
+	query := httpReq.URL.Query()
+	query.Set("user", userID.String())
+	query.Set("otherUser", otherUserID.String())
+	httpReq.URL.RawQuery = query.Encode()
+
+	return c.doWithAuthToken(ctx, httpReq, nil)
+}
@@ -0,0 +1,164 @@
+// Package groupme defines a client capable of executing API commands for the GroupMe chat service
+package groupmeclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// GroupMe documentation: https://dev.groupme.com/docs/v3#bots
+
+/*//////// Endpoints ////////*/
+const (
+	// Used to build other endpoints
+	botsEndpointRoot = "/bots"
+
+	// Actual Endpoints
+	indexBotsEndpoint      = botsEndpointRoot              // GET
+	createBotEndpoint      = botsEndpointRoot              // POST
+	postBotMessageEndpoint = botsEndpointRoot + "/post"    // POST
+	destroyBotEndpoint     = botsEndpointRoot + "/destroy" // POST
+)
+
+/*//////// API Requests ////////*/
+
+/*/// Index ///*/
+
+/*
+IndexBots -
+
+List bots that you have created
+*/
+func (c *Client) IndexBots(ctx context.Context) ([]*Bot, error) {
+	httpReq, err := http.NewRequest("GET", c.endpointBase+indexBotsEndpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp []*Bot
+	err = c.doWithAuthToken(ctx, httpReq, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+/*/// Create ///*/
+
+/*
+CreateBot -
+
+Create a bot. See the Bots Tutorial (https://dev.groupme.com/tutorials/bots)
+for a full walkthrough.
+
+Parameters:
+
+	See Bot
+		Name - required
+		GroupID - required
+*/
+func (c *Client) CreateBot(ctx context.Context, bot *Bot) (*Bot, error) {
+	URL := fmt.Sprintf(c.endpointBase + createBotEndpoint)
+
+	var data = struct {
+		Bot *Bot `json:"bot"`
+	}{
+		bot,
+	}
+
+	jsonBytes, err := json.Marshal(&data)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequest("POST", URL, bytes.NewBuffer(jsonBytes))
+	if err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		*Bot `json:"bot"`
+	}
+	err = c.doWithAuthToken(ctx, httpReq, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Bot, nil
+}
+
+/*/// Post Message ///*/
+
+/*
+PostBotMessage -
+
+Post a message from a bot.
+
+Parameters:
+
+	botID - required, ID(string)
+	text - required, string
+	pictureURL - optional, string. Must be an image service URL (i.groupme.com)
+*/
+func (c *Client) PostBotMessage(ctx context.Context, botID ID, text string, pictureURL string) error {
+	URL := fmt.Sprintf(c.endpointBase + postBotMessageEndpoint)
+
+	var data = struct {
+		BotID      ID     `json:"bot_id"`
+		Text       string `json:"text"`
+		PictureURL string `json:"picture_url,omitempty"`
+	}{
+		botID,
+		text,
+		pictureURL,
+	}
+
+	jsonBytes, err := json.Marshal(&data)
+	if err != nil {
+		return err
+	}
+
+	httpReq, err := http.NewRequest("POST", URL, bytes.NewBuffer(jsonBytes))
+	if err != nil {
+		return err
+	}
+
+	return c.do(ctx, httpReq, nil)
+}
+
+/*/// Destroy ///*/
+
+/*
+DestroyBot -
+
+Remove a bot that you have created.
+
+Parameters:
+
+	botID - required, ID(string)
+*/
+func (c *Client) DestroyBot(ctx context.Context, botID ID) error {
+	URL := fmt.Sprintf(c.endpointBase + destroyBotEndpoint)
+
+	var data = struct {
+		BotID ID `json:"bot_id"`
+	}{
+		botID,
+	}
+
+	jsonBytes, err := json.Marshal(&data)
+	if err != nil {
+		return err
+	}
+
+	httpReq, err := http.NewRequest("POST", URL, bytes.NewBuffer(jsonBytes))
+	if err != nil {
+		return err
+	}
+
+	return c.doWithAuthToken(ctx, httpReq, nil)
+}
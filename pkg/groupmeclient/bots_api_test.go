@@ -0,0 +1,96 @@
+package groupmeclient_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/GroveJay/matrix-groupme-bridge/pkg/groupmeclient"
+	"github.com/GroveJay/matrix-groupme-bridge/pkg/groupmetest"
+)
+
+func newBotsTestServer(t *testing.T) (*groupmeclient.Client, *groupmetest.Server) {
+	t.Helper()
+	server := groupmetest.NewServer("token", &groupmeclient.User{ID: "1", Name: "Me"})
+	t.Cleanup(server.Close)
+	server.AddGroup(&groupmeclient.Group{ID: "10", Name: "Group"})
+	return server.NewClient(), server
+}
+
+func TestCreateBot(t *testing.T) {
+	client, server := newBotsTestServer(t)
+
+	bot, err := client.CreateBot(context.Background(), &groupmeclient.Bot{Name: "Bot", GroupID: "10"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bot.BotID == "" || bot.Name != "Bot" || bot.GroupID != "10" {
+		t.Errorf("CreateBot() = %v, want a bot named Bot in group 10 with an ID", bot)
+	}
+	var req struct {
+		Bot groupmeclient.Bot `json:"bot"`
+	}
+	if requests := server.RequestsTo("POST", "/v3/bots"); len(requests) != 1 {
+		t.Fatalf("got %d requests to create the bot, want 1", len(requests))
+	} else if err := requests[0].Decode(&req); err != nil {
+		t.Fatal(err)
+	} else if req.Bot.Name != "Bot" || req.Bot.GroupID != "10" {
+		t.Errorf("sent bot %+v, want name Bot and group 10", req.Bot)
+	}
+
+	bots, err := client.IndexBots(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	} else if len(bots) != 1 || bots[0].BotID != bot.BotID {
+		t.Errorf("IndexBots() = %v, want the created bot", bots)
+	}
+}
+
+func TestPostBotMessage(t *testing.T) {
+	client, server := newBotsTestServer(t)
+	bot, err := client.CreateBot(context.Background(), &groupmeclient.Bot{Name: "Bot", GroupID: "10"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.PostBotMessage(context.Background(), bot.BotID, "Hello", ""); err != nil {
+		t.Fatal(err)
+	}
+	messages := server.Messages("10")
+	if len(messages) != 1 {
+		t.Fatalf("group has %d messages, want 1", len(messages))
+	}
+	message := messages[0]
+	if message.Text != "Hello" || message.SenderType != groupmeclient.SenderTypeBot || message.SenderID != bot.BotID {
+		t.Errorf("posted %v, want Hello sent by bot %s", message, bot.BotID)
+	}
+	// Bots authenticate with their ID, the access token isn't sent
+	request := server.RequestsTo("POST", "/v3/bots/post")[0]
+	if request.Query.Has("token") || request.Header.Get("X-Access-Token") != "" {
+		t.Error("bot message was sent with the access token")
+	}
+
+	if err := client.PostBotMessage(context.Background(), "unknown", "Hello", ""); !errors.Is(err, groupmeclient.ErrNotFound) {
+		t.Errorf("PostBotMessage() for an unknown bot = %v, want ErrNotFound", err)
+	}
+}
+
+func TestDestroyBot(t *testing.T) {
+	client, _ := newBotsTestServer(t)
+	bot, err := client.CreateBot(context.Background(), &groupmeclient.Bot{Name: "Bot", GroupID: "10"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.DestroyBot(context.Background(), bot.BotID); err != nil {
+		t.Fatal(err)
+	}
+	if bots, err := client.IndexBots(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if len(bots) != 0 {
+		t.Errorf("IndexBots() after DestroyBot = %v, want none", bots)
+	}
+	if err := client.DestroyBot(context.Background(), bot.BotID); !errors.Is(err, groupmeclient.ErrNotFound) {
+		t.Errorf("DestroyBot() of a destroyed bot = %v, want ErrNotFound", err)
+	}
+}
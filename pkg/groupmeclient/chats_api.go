@@ -32,6 +32,8 @@ func (c *Client) IndexChats(ctx context.Context, req *IndexChatsQuery) ([]*Chat,
 	if err != nil {
 		return nil, err
 	}
+	// Unchanged listings are answered from the last response
+	httpReq = setConditional(httpReq)
 
 	URL := httpReq.URL
 	query := URL.Query()
@@ -7,10 +7,11 @@ import (
 	"encoding/json"
 	"io"
 	"net/http"
+	"time"
 )
 
 // GroupMeAPIBase - Endpoints are added on to this to get the full URI.
-// Overridable for testing
+// Overridable with WithAPIBase
 const (
 	GroupMeAPIPath = "https://api.groupme.com/"
 	GroupMeAPIBase = GroupMeAPIPath + "v3"
@@ -21,17 +22,95 @@ const (
 type Client struct {
 	httpClient         *http.Client
 	endpointBase       string
+	endpointBaseV4     string
+	imageServiceBase   string
 	authorizationToken string
+	userAgent          string
+	// Called on every request right before it's sent
+	requestHooks []func(*http.Request)
+	// Called with the error of every request GroupMe rejected with 401
+	unauthorizedHandler func(error)
+	limiter             *rateLimiter
+	conditional         *conditionalCache
+}
+
+// ClientOption configures a Client created by NewClient
+type ClientOption func(*Client)
+
+// WithAPIBase sets the base URL of the v3 API, e.g. to point the Client at a local stand-in
+func WithAPIBase(base string) ClientOption {
+	return func(c *Client) {
+		c.endpointBase = base
+	}
+}
+
+// WithAPIBaseV4 sets the base URL of the undocumented v4 API
+func WithAPIBaseV4(base string) ClientOption {
+	return func(c *Client) {
+		c.endpointBaseV4 = base
+	}
+}
+
+// WithImageServiceBase sets the base URL of the image service
+func WithImageServiceBase(base string) ClientOption {
+	return func(c *Client) {
+		c.imageServiceBase = base
+	}
+}
+
+// WithHTTPClient sets the http.Client every request is sent with
+func WithHTTPClient(httpClient *http.Client) ClientOption {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithTransport sets the RoundTripper of the Client's http.Client,
+// without modifying an http.Client passed to WithHTTPClient
+func WithTransport(transport http.RoundTripper) ClientOption {
+	return func(c *Client) {
+		httpClient := *c.httpClient
+		httpClient.Transport = transport
+		c.httpClient = &httpClient
+	}
+}
+
+// WithUserAgent sets the User-Agent header of every request
+func WithUserAgent(userAgent string) ClientOption {
+	return func(c *Client) {
+		c.userAgent = userAgent
+	}
+}
+
+// WithRequestHook adds a function that is called with every request right before it's sent,
+// after the access token was added. Hooks run in the order they were added.
+func WithRequestHook(hook func(*http.Request)) ClientOption {
+	return func(c *Client) {
+		c.requestHooks = append(c.requestHooks, hook)
+	}
 }
 
 // NewClient creates a new GroupMe API Client
-func NewClient(authToken string) *Client {
-	return &Client{
-		// TODO: enable transport information passing in
+func NewClient(authToken string, options ...ClientOption) *Client {
+	c := &Client{
 		httpClient:         &http.Client{},
 		endpointBase:       GroupMeAPIBase,
+		endpointBaseV4:     GroupMeAPIBaseV4,
+		imageServiceBase:   GroupMeImageServiceBase,
 		authorizationToken: authToken,
+		limiter:            newRateLimiter(),
+		conditional:        newConditionalCache(),
+	}
+	for _, option := range options {
+		option(c)
 	}
+	return c
+}
+
+// OnUnauthorized sets a function that is called whenever GroupMe rejects the
+// authorization token, e.g. because it was revoked
+func (c *Client) OnUnauthorized(handler func(error)) {
+	c.unauthorizedHandler = handler
 }
 
 // Close safely shuts down the Client
@@ -63,58 +142,146 @@ func (r response) UnmarshalJSON(bs []byte) error {
 	return json.NewDecoder(bytes.NewBuffer(bs)).Decode(r.i)
 }
 
+// The image service wraps its results in "payload" rather than "response"
+type payloadResponse struct {
+	Payload response `json:"payload"`
+}
+
+type payloadKey struct{}
+
+// setPayloadResponse marks a request whose response is wrapped like the image service's
+func setPayloadResponse(req *http.Request) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), payloadKey{}, true))
+}
+
+func isPayloadResponse(req *http.Request) bool {
+	payload, _ := req.Context().Value(payloadKey{}).(bool)
+	return payload
+}
+
+func decodeResponse(readBytes []byte, payload bool, i interface{}) error {
+	if payload {
+		return json.Unmarshal(readBytes, &payloadResponse{Payload: response{i}})
+	}
+	resp := newJSONResponse(i)
+	return json.Unmarshal(readBytes, &resp)
+}
+
 const errorStatusCodeMin = 300
 
 func (c Client) do(ctx context.Context, req *http.Request, i interface{}) error {
+	retryable := isRetryable(req)
+	conditional := isConditional(req)
+	payload := isPayloadResponse(req)
 	req = req.WithContext(ctx)
-	if req.Method == "POST" {
+	if conditional {
+		c.conditional.prepare(req)
+	}
+	c.prepareRequest(req)
+	if req.Method == "POST" && req.Header.Get("Content-Type") == "" {
 		req.Header.Set("Content-Type", "application/json")
 	}
 
-	getResp, err := c.httpClient.Do(req)
-	if err != nil {
-		return err
+	for attempt := 0; ; attempt++ {
+		if err := c.limiter.wait(ctx); err != nil {
+			return err
+		}
+
+		getResp, err := c.httpClient.Do(req)
+		if err != nil {
+			return err
+		}
+
+		if retryable && attempt < maxRetries && shouldRetry(getResp.StatusCode) {
+			delay := retryDelay(getResp, attempt)
+			getResp.Body.Close()
+			if err := rewindBody(req); err != nil {
+				return err
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(delay):
+			}
+			continue
+		}
+
+		return c.handleResponse(getResp, conditional, payload, i)
 	}
+}
+
+func (c Client) handleResponse(getResp *http.Response, conditional, payload bool, i interface{}) error {
 	defer getResp.Body.Close()
 
 	var readBytes []byte
-	// Check Status Code is 1XX or 2XX
-	if getResp.StatusCode >= errorStatusCodeMin {
-		readBytes, err = io.ReadAll(getResp.Body)
-		if err != nil {
-			// We couldn't read the output.  Oh well; generate the appropriate error type anyway.
-			return &Meta{
-				Code: HTTPStatusCode(getResp.StatusCode),
-			}
+	// Nothing new, which GroupMe also uses for running out of messages while paginating
+	if getResp.StatusCode == int(HTTPNotModified) {
+		if !conditional || i == nil {
+			return nil
+		}
+		readBytes = c.conditional.cached(getResp.Request)
+		if readBytes == nil {
+			return nil
 		}
+		return decodeResponse(readBytes, payload, i)
+	}
 
-		resp := newJSONResponse(nil)
-		if err = json.Unmarshal(readBytes, &resp); err != nil {
-			// We couldn't parse the output.  Oh well; generate the appropriate error type anyway.
-			return &Meta{
-				Code: HTTPStatusCode(getResp.StatusCode),
-			}
+	// Check Status Code is 1XX or 2XX
+	if getResp.StatusCode >= errorStatusCodeMin {
+		meta := errorMeta(getResp)
+		meta.Method = getResp.Request.Method
+		meta.URL = redactURL(getResp.Request.URL)
+		if getResp.StatusCode == int(HTTPUnauthorized) && c.unauthorizedHandler != nil {
+			c.unauthorizedHandler(meta)
 		}
-		return &resp.Meta
+		return meta
 	}
 
 	if i == nil {
 		return nil
 	}
 
-	readBytes, err = io.ReadAll(getResp.Body)
+	readBytes, err := io.ReadAll(getResp.Body)
 	if err != nil {
 		return err
 	}
 
-	resp := newJSONResponse(i)
-	if err := json.Unmarshal(readBytes, &resp); err != nil {
+	if err := decodeResponse(readBytes, payload, i); err != nil {
 		return err
 	}
+	if conditional {
+		c.conditional.store(getResp, readBytes)
+	}
 
 	return nil
 }
 
+// prepareRequest applies the configured user agent and request hooks
+func (c Client) prepareRequest(req *http.Request) {
+	if c.userAgent != "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
+	for _, hook := range c.requestHooks {
+		hook(req)
+	}
+}
+
+// errorMeta reads the error GroupMe responded with
+func errorMeta(resp *http.Response) *Meta {
+	meta := &Meta{}
+	// If the output can't be read or parsed, generate the appropriate error type anyway.
+	if readBytes, err := io.ReadAll(resp.Body); err == nil {
+		jsonResp := newJSONResponse(nil)
+		if err = json.Unmarshal(readBytes, &jsonResp); err == nil {
+			meta = &jsonResp.Meta
+		}
+	}
+	if meta.Code == 0 {
+		meta.Code = HTTPStatusCode(resp.StatusCode)
+	}
+	return meta
+}
+
 func (c Client) doWithAuthToken(ctx context.Context, req *http.Request, i interface{}) error {
 	URL := req.URL
 	query := URL.Query()
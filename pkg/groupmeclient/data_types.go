@@ -71,6 +71,7 @@ const (
 	HTTPForbidden           HTTPStatusCode = 403
 	HTTPNotFound            HTTPStatusCode = 404
 	HTTPEnhanceYourCalm     HTTPStatusCode = 420
+	HTTPTooManyRequests     HTTPStatusCode = 429
 	HTTPInternalServerError HTTPStatusCode = 500
 	HTTPBadGateway          HTTPStatusCode = 502
 	HTTPServiceUnavailable  HTTPStatusCode = 503
@@ -88,6 +89,7 @@ func (c HTTPStatusCode) String() string {
 		HTTPForbidden:           "request refused due to update limits",
 		HTTPNotFound:            "URI is invalid or resource does not exist",
 		HTTPEnhanceYourCalm:     "application is being rate limited",
+		HTTPTooManyRequests:     "too many requests, try again later",
 		HTTPInternalServerError: "something unexpected occurred",
 		HTTPBadGateway:          "GroupMe is down or being upgraded",
 		HTTPServiceUnavailable:  "servers are overloaded, try again later",
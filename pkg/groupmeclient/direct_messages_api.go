@@ -56,8 +56,8 @@ Fetch direct messages between two users.
 DMs are returned in groups of 20, ordered by created_at
 descending.
 
-If no messages are found (e.g. when filtering with since_id) we
-return code 304.
+If no messages are found (e.g. when filtering with since_id)
+GroupMe returns code 304, which results in an empty response.
 
 Note that for historical reasons, likes are returned as an array
 of user ids in the favorited_by key.
@@ -127,6 +127,8 @@ func (c *Client) CreateDirectMessage(ctx context.Context, m *Message) (*Message,
 	if err != nil {
 		return nil, err
 	}
+	// GroupMe drops messages with a SourceGUID it has already seen, so sending it again is safe
+	httpReq = setRetryable(httpReq, true)
 
 	var resp struct {
 		*Message `json:"direct_message"`
@@ -0,0 +1,41 @@
+// Package groupme defines a client capable of executing API commands for the GroupMe chat service
+package groupmeclient
+
+import (
+	"errors"
+	"net/url"
+)
+
+// Errors that a *Meta returned by the Client matches through errors.Is
+var (
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+	ErrNotFound     = errors.New("not found")
+	ErrRateLimited  = errors.New("rate limited")
+)
+
+func statusCodeError(code HTTPStatusCode) error {
+	switch code {
+	case HTTPUnauthorized:
+		return ErrUnauthorized
+	case HTTPForbidden:
+		return ErrForbidden
+	case HTTPNotFound:
+		return ErrNotFound
+	case HTTPEnhanceYourCalm, HTTPTooManyRequests:
+		return ErrRateLimited
+	default:
+		return nil
+	}
+}
+
+// redactURL strips the access token so the URL can end up in errors and logs
+func redactURL(u *url.URL) string {
+	redacted := *u
+	query := redacted.Query()
+	if query.Has("token") {
+		query.Set("token", "REDACTED")
+		redacted.RawQuery = query.Encode()
+	}
+	return redacted.String()
+}
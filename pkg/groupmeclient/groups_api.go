@@ -8,7 +8,9 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 )
 
 // GroupMe documentation: https://dev.groupme.com/docs/v3#groups
@@ -31,6 +33,9 @@ const (
 	changeGroupOwnerEndpoint = groupsEndpointRoot + "/change_owners" // POST
 )
 
+// ErrInvalidShareURL is returned by ParseShareURL for URLs that aren't GroupMe share links
+var ErrInvalidShareURL = errors.New("not a GroupMe share URL")
+
 /*//////// Common Request Parameters ////////*/
 
 // GroupSettings is the settings for a group, used by CreateGroup and UpdateGroup
@@ -53,6 +58,18 @@ func (gss GroupSettings) String() string {
 	return marshal(&gss)
 }
 
+// Settings returns the current GroupSettings of the group, so that
+// a single field can be changed without clobbering the others
+func (g *Group) Settings() GroupSettings {
+	return GroupSettings{
+		Name:        g.Name,
+		Description: g.Description,
+		ImageURL:    g.ImageURL,
+		OfficeMode:  g.OfficeMode,
+		Share:       g.ShareURL != "",
+	}
+}
+
 /*//////// API Requests ////////*/
 
 /*/// Index ///*/
@@ -91,6 +108,8 @@ func (c *Client) IndexGroups(ctx context.Context, req *GroupsQuery) ([]*Group, e
 	if err != nil {
 		return nil, err
 	}
+	// Unchanged listings are answered from the last response
+	httpReq = setConditional(httpReq)
 
 	URL := httpReq.URL
 	query := URL.Query()
@@ -128,6 +147,8 @@ func (c *Client) FormerGroups(ctx context.Context) ([]*Group, error) {
 	if err != nil {
 		return nil, err
 	}
+	// Unchanged listings are answered from the last response
+	httpReq = setConditional(httpReq)
 
 	var resp []*Group
 	err = c.doWithAuthToken(ctx, httpReq, &resp)
@@ -284,6 +305,36 @@ func (c *Client) JoinGroup(ctx context.Context, groupID ID, shareToken string) (
 	return &resp, nil
 }
 
+/*
+ParseShareURL -
+
+Extracts the group ID and share token from a share URL, as found in
+Group.ShareURL (https://groupme.com/join_group/<group ID>/<share token>).
+
+Parameters:
+
+	shareURL - required, string
+*/
+func ParseShareURL(shareURL string) (ID, string, error) {
+	parsedURL, err := url.Parse(strings.TrimSpace(shareURL))
+	if err != nil {
+		return "", "", ErrInvalidShareURL
+	}
+	if parsedURL.Host != "groupme.com" && !strings.HasSuffix(parsedURL.Host, ".groupme.com") {
+		return "", "", ErrInvalidShareURL
+	}
+	parts := strings.Split(strings.Trim(parsedURL.Path, "/"), "/")
+	if len(parts) != 3 || parts[0] != "join_group" || parts[2] == "" {
+		return "", "", ErrInvalidShareURL
+	}
+	// Group IDs are numeric, unlike the IDs of other objects
+	groupID := ID(parts[1])
+	if groupID == "" || strings.Trim(parts[1], "0123456789") != "" {
+		return "", "", ErrInvalidShareURL
+	}
+	return groupID, parts[2], nil
+}
+
 /*/// Rejoin ///*/
 
 /*
@@ -0,0 +1,38 @@
+package groupmeclient
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseShareURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		groupID ID
+		token   string
+		err     error
+	}{
+		{"groupme.com", "https://groupme.com/join_group/123/abcDEF", "123", "abcDEF", nil},
+		{"web.groupme.com", "https://web.groupme.com/join_group/123/abcDEF", "123", "abcDEF", nil},
+		{"surrounding whitespace", " https://groupme.com/join_group/123/abcDEF/ \n", "123", "abcDEF", nil},
+		{"foreign host", "https://example.com/join_group/123/abcDEF", "", "", ErrInvalidShareURL},
+		{"foreign host ending in groupme.com", "https://notgroupme.com/join_group/123/abcDEF", "", "", ErrInvalidShareURL},
+		{"missing token", "https://groupme.com/join_group/123", "", "", ErrInvalidShareURL},
+		{"empty token", "https://groupme.com/join_group/123/", "", "", ErrInvalidShareURL},
+		{"missing ID", "https://groupme.com/join_group//abcDEF", "", "", ErrInvalidShareURL},
+		{"non-numeric ID", "https://groupme.com/join_group/abc/abcDEF", "", "", ErrInvalidShareURL},
+		{"other path", "https://groupme.com/groups/123/abcDEF", "", "", ErrInvalidShareURL},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			groupID, token, err := ParseShareURL(test.url)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("ParseShareURL(%q) error = %v, want %v", test.url, err, test.err)
+			}
+			if groupID != test.groupID || token != test.token {
+				t.Errorf("ParseShareURL(%q) = (%q, %q), want (%q, %q)", test.url, groupID, token, test.groupID, test.token)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+// Package groupme defines a client capable of executing API commands for the GroupMe chat service
+package groupmeclient
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+)
+
+// GroupMe documentation: https://dev.groupme.com/docs/image_service
+
+// GroupMeImageServiceBase - Image uploads are sent here rather than to the API
+const GroupMeImageServiceBase = "https://image.groupme.com"
+
+/*//////// Endpoints ////////*/
+const (
+	uploadImageEndpoint = "/pictures" // POST
+)
+
+// ImageServiceResponse is the payload returned by the image service
+type ImageServiceResponse struct {
+	URL        string `json:"url"`
+	PictureURL string `json:"picture_url"`
+}
+
+func (r ImageServiceResponse) String() string {
+	return marshal(&r)
+}
+
+/*
+UploadImage -
+
+Processes an image through the GroupMe image service so that
+it can be used as a group avatar or message attachment.
+
+Parameters:
+
+	data - required, the raw image bytes
+	contentType - required, the mime type of the image (e.g. image/jpeg)
+*/
+func (c *Client) UploadImage(ctx context.Context, data []byte, contentType string) (*ImageServiceResponse, error) {
+	httpReq, err := http.NewRequest("POST", c.imageServiceBase+uploadImageEndpoint, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", contentType)
+	httpReq.Header.Set("X-Access-Token", c.authorizationToken)
+	// Uploading the same image twice only creates another URL for it
+	httpReq = setRetryable(setPayloadResponse(httpReq), true)
+
+	var resp ImageServiceResponse
+	err = c.do(ctx, httpReq, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
@@ -0,0 +1,40 @@
+package groupmeclient_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/GroveJay/matrix-groupme-bridge/pkg/groupmeclient"
+	"github.com/GroveJay/matrix-groupme-bridge/pkg/groupmetest"
+)
+
+func TestUploadImageRetries(t *testing.T) {
+	server := groupmetest.NewServer("token", &groupmeclient.User{ID: "1", Name: "Me"})
+	defer server.Close()
+	server.Fail("POST", "/image/pictures", 429, 1)
+	data := []byte("\x89PNG")
+
+	image, err := server.NewClient().UploadImage(context.Background(), data, "image/png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if image.URL == "" || image.PictureURL == "" {
+		t.Errorf("UploadImage() = %v, want the URLs from the payload", image)
+	}
+	requests := server.RequestsTo("POST", "/image/pictures")
+	if len(requests) != 2 {
+		t.Fatalf("got %d upload requests, want 2", len(requests))
+	}
+	for _, req := range requests {
+		if !bytes.Equal(req.Body, data) {
+			t.Errorf("uploaded %q, want %q", req.Body, data)
+		}
+		if contentType := req.Header.Get("Content-Type"); contentType != "image/png" {
+			t.Errorf("uploaded with Content-Type %q, want image/png", contentType)
+		}
+		if token := req.Header.Get("X-Access-Token"); token != "token" {
+			t.Errorf("uploaded with token %q, want token", token)
+		}
+	}
+}
@@ -11,14 +11,25 @@ import (
 type Meta struct {
 	Code   HTTPStatusCode `json:"code,omitempty"`
 	Errors []string       `json:"errors,omitempty"`
+	// Request that failed, the URL never contains the access token
+	Method string `json:"-"`
+	URL    string `json:"-"`
 }
 
 // Error returns the code and the error list as a string.
 // Satisfies the error interface
 func (m Meta) Error() string {
+	if m.Method != "" {
+		return fmt.Sprintf("%s %s: Error Code %d: %v", m.Method, m.URL, m.Code, m.Errors)
+	}
 	return fmt.Sprintf("Error Code %d: %v", m.Code, m.Errors)
 }
 
+// Is matches the sentinel error of the status code, e.g. errors.Is(err, ErrNotFound)
+func (m Meta) Is(target error) bool {
+	return target != nil && statusCodeError(m.Code) == target
+}
+
 // Group is a GroupMe group, returned in JSON API responses
 type Group struct {
 	ID   ID     `json:"id,omitempty"`
@@ -32,6 +43,7 @@ type Group struct {
 	UpdatedAt     Timestamp     `json:"updated_at,omitempty"`
 	Members       []*Member     `json:"members,omitempty"`
 	ShareURL      string        `json:"share_url,omitempty"`
+	OfficeMode    bool          `json:"office_mode,omitempty"`
 	Messages      GroupMessages `json:"messages,omitempty"`
 }
 
@@ -82,22 +94,44 @@ func (g *Group) String() string {
 
 // Member is a GroupMe group member, returned in JSON API responses
 type Member struct {
-	ID           ID     `json:"id,omitempty"`
-	UserID       ID     `json:"user_id,omitempty"`
-	Nickname     string `json:"nickname,omitempty"`
-	Muted        bool   `json:"muted,omitempty"`
-	ImageURL     string `json:"image_url,omitempty"`
-	AutoKicked   bool   `json:"autokicked,omitempty"`
-	AppInstalled bool   `json:"app_installed,omitempty"`
-	GUID         string `json:"guid,omitempty"`
-	PhoneNumber  string `json:"phone_number,omitempty"` // Only used when searching for the member to add to a group.
-	Email        string `json:"email,omitempty"`        // Only used when searching for the member to add to a group.
+	ID           ID           `json:"id,omitempty"`
+	UserID       ID           `json:"user_id,omitempty"`
+	Nickname     string       `json:"nickname,omitempty"`
+	Muted        bool         `json:"muted,omitempty"`
+	ImageURL     string       `json:"image_url,omitempty"`
+	AutoKicked   bool         `json:"autokicked,omitempty"`
+	AppInstalled bool         `json:"app_installed,omitempty"`
+	GUID         string       `json:"guid,omitempty"`
+	Roles        []MemberRole `json:"roles,omitempty"`
+	PhoneNumber  string       `json:"phone_number,omitempty"` // Only used when searching for the member to add to a group.
+	Email        string       `json:"email,omitempty"`        // Only used when searching for the member to add to a group.
 }
 
 func (m *Member) String() string {
 	return marshal(m)
 }
 
+// HasRole checks if the member has been given the role in the group
+func (m *Member) HasRole(role MemberRole) bool {
+	for _, r := range m.Roles {
+		if r == role {
+			return true
+		}
+	}
+
+	return false
+}
+
+// MemberRole is a permission level a member can hold in a group
+type MemberRole string
+
+// MemberRole constants
+const (
+	MemberRoleUser  MemberRole = "user"
+	MemberRoleAdmin MemberRole = "admin"
+	MemberRoleOwner MemberRole = "owner"
+)
+
 // Message is a GroupMe group message, returned in JSON API responses
 type Message struct {
 	ID          ID         `json:"id,omitempty"`
@@ -179,6 +213,8 @@ type User struct {
 	AvatarURL   string      `json:"avatar_url,omitempty"`
 	Email       string      `json:"email,omitempty"`
 	SMS         bool        `json:"sms,omitempty"`
+	// Only returned by IndexRelations
+	Blocked bool `json:"blocked,omitempty"`
 }
 
 func (u *User) String() string {
@@ -199,6 +235,20 @@ func (c *Chat) String() string {
 	return marshal(c)
 }
 
+// ReadReceipt marks how far a user has read in a conversation,
+// returned in JSON API responses and push events
+type ReadReceipt struct {
+	ID        ID        `json:"id,omitempty"`
+	ChatID    ID        `json:"chat_id,omitempty"`
+	MessageID ID        `json:"message_id,omitempty"`
+	UserID    ID        `json:"user_id,omitempty"`
+	ReadAt    Timestamp `json:"read_at,omitempty"`
+}
+
+func (r *ReadReceipt) String() string {
+	return marshal(r)
+}
+
 // Bot is a GroupMe bot, it is connected to a specific group which it can send messages to
 type Bot struct {
 	BotID          ID     `json:"bot_id,omitempty"`
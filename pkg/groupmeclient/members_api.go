@@ -0,0 +1,306 @@
+// Package groupme defines a client capable of executing API commands for the GroupMe chat service
+package groupmeclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// GroupMe documentation: https://dev.groupme.com/docs/v3#members
+
+/*//////// Endpoints ////////*/
+const (
+	// Used to build other endpoints
+	membersEndpointRoot     = groupEndpointRoot + "/members"
+	membershipsEndpointRoot = groupEndpointRoot + "/memberships"
+
+	// Actual Endpoints
+	addMembersEndpoint       = membersEndpointRoot + "/add"        // POST
+	memberResultsEndpoint    = membersEndpointRoot + "/results/%s" // GET
+	removeMemberEndpoint     = membersEndpointRoot + "/%s/remove"  // POST
+	updateMembershipEndpoint = membershipsEndpointRoot + "/update" // POST
+	muteMembershipEndpoint   = membershipsEndpointRoot + "/mute"   // POST
+	unmuteMembershipEndpoint = membershipsEndpointRoot + "/unmute" // POST
+)
+
+// How often MemberResults asks GroupMe whether an add request has finished
+var memberResultsPollInterval = time.Second
+
+// ErrMemberResultsExpired is returned by MemberResults when the results
+// of an add request are no longer available (after one hour)
+var ErrMemberResultsExpired = errors.New("member results expired")
+
+/*//////// API Requests ////////*/
+
+/*/// Add ///*/
+
+/*
+AddMembers -
+
+Add members to a group.
+
+Multiple members can be added in a single request, and results
+are fetched with a separate call (since memberships are processed
+asynchronously). The response includes a results_id that's used
+in the results request.
+
+In order to correlate request params with resulting memberships,
+GUIDs should be added to the members parameters. These GUIDs will
+be reflected in the membership JSON objects. A GUID is generated
+for any member that does not have one.
+
+Parameters:
+
+	groupID - required, ID(string)
+	See Member.
+		Nickname - required
+		One of the following identifiers must be used:
+			UserID - ID(string)
+			PhoneNumber - string
+			Email - string
+*/
+func (c *Client) AddMembers(ctx context.Context, groupID ID, members ...*Member) (string, error) {
+	URL := fmt.Sprintf(c.endpointBase+addMembersEndpoint, groupID)
+
+	for _, member := range members {
+		if member.GUID == "" {
+			member.GUID = uuid.New().String()
+		}
+	}
+
+	var data = struct {
+		Members []*Member `json:"members"`
+	}{
+		members,
+	}
+
+	jsonBytes, err := json.Marshal(&data)
+	if err != nil {
+		return "", err
+	}
+
+	httpReq, err := http.NewRequest("POST", URL, bytes.NewBuffer(jsonBytes))
+	if err != nil {
+		return "", err
+	}
+
+	var resp struct {
+		ResultsID string `json:"results_id"`
+	}
+	err = c.doWithAuthToken(ctx, httpReq, &resp)
+	if err != nil {
+		return "", err
+	}
+
+	return resp.ResultsID, nil
+}
+
+/*/// Results ///*/
+
+/*
+MemberResults -
+
+Get the membership results from an add call.
+
+Successfully created memberships will be returned, including
+any GUIDs that were sent up in the add request. If GUIDs were
+absent, they are filled in automatically. Failed memberships
+and invites are omitted.
+
+GroupMe responds with 503 while the results are not ready yet,
+so this polls until they are, the timeout passes, or the context
+is cancelled. Results expire after one hour, at which point
+ErrMemberResultsExpired is returned.
+
+Parameters:
+
+	groupID - required, ID(string)
+	resultsID - required, string
+	timeout - required, how long to keep polling
+*/
+func (c *Client) MemberResults(ctx context.Context, groupID ID, resultsID string, timeout time.Duration) ([]*Member, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for {
+		members, err := c.memberResults(ctx, groupID, resultsID)
+		var meta *Meta
+		if !errors.As(err, &meta) || meta.Code != HTTPServiceUnavailable {
+			return members, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(memberResultsPollInterval):
+		}
+	}
+}
+
+func (c *Client) memberResults(ctx context.Context, groupID ID, resultsID string) ([]*Member, error) {
+	URL := fmt.Sprintf(c.endpointBase+memberResultsEndpoint, groupID, resultsID)
+
+	httpReq, err := http.NewRequest("GET", URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	// 503 means the results aren't ready yet, which MemberResults polls for itself
+	httpReq = setRetryable(httpReq, false)
+
+	var resp struct {
+		Members []*Member `json:"members"`
+	}
+	err = c.doWithAuthToken(ctx, httpReq, &resp)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, ErrMemberResultsExpired
+		}
+		return nil, err
+	}
+
+	return resp.Members, nil
+}
+
+/*/// Remove ///*/
+
+/*
+RemoveMember -
+
+Remove a member (or yourself) from a group.
+
+Note: The creator of the group cannot be removed or exit.
+
+Parameters:
+
+	groupID - required, ID(string)
+	membershipID - required, ID(string). Not the same as userID
+*/
+func (c *Client) RemoveMember(ctx context.Context, groupID, membershipID ID) error {
+	URL := fmt.Sprintf(c.endpointBase+removeMemberEndpoint, groupID, membershipID)
+
+	httpReq, err := http.NewRequest("POST", URL, nil)
+	if err != nil {
+		return err
+	}
+
+	return c.doWithAuthToken(ctx, httpReq, nil)
+}
+
+/*/// Update ///*/
+
+/*
+UpdateMembership -
+
+Update your nickname in a group. The nickname must be
+between 1 and 50 characters.
+
+Parameters:
+
+	groupID - required, ID(string)
+	nickname - required, string
+*/
+func (c *Client) UpdateMembership(ctx context.Context, groupID ID, nickname string) (*Member, error) {
+	URL := fmt.Sprintf(c.endpointBase+updateMembershipEndpoint, groupID)
+
+	type Nickname struct {
+		Nickname string `json:"nickname"`
+	}
+	var data = struct {
+		Membership Nickname `json:"membership"`
+	}{
+		Nickname{nickname},
+	}
+
+	jsonBytes, err := json.Marshal(&data)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequest("POST", URL, bytes.NewBuffer(jsonBytes))
+	if err != nil {
+		return nil, err
+	}
+
+	var resp Member
+	err = c.doWithAuthToken(ctx, httpReq, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+/*/// Mute ///*/
+
+/*
+MuteMembership -
+
+Mute notifications from a group for yourself.
+
+Parameters:
+
+	groupID - required, ID(string)
+	duration - optional, time.Duration. Rounded up to minutes, mutes indefinitely if 0
+*/
+func (c *Client) MuteMembership(ctx context.Context, groupID ID, duration time.Duration) (*Member, error) {
+	URL := fmt.Sprintf(c.endpointBase+muteMembershipEndpoint, groupID)
+
+	var data = struct {
+		Duration int `json:"duration,omitempty"`
+	}{
+		// A duration under a minute would otherwise round to 0 and mute indefinitely
+		int(math.Ceil(duration.Minutes())),
+	}
+
+	jsonBytes, err := json.Marshal(&data)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequest("POST", URL, bytes.NewBuffer(jsonBytes))
+	if err != nil {
+		return nil, err
+	}
+
+	var resp Member
+	err = c.doWithAuthToken(ctx, httpReq, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+/*
+UnmuteMembership -
+
+Unmute notifications from a group for yourself.
+
+Parameters:
+
+	groupID - required, ID(string)
+*/
+func (c *Client) UnmuteMembership(ctx context.Context, groupID ID) (*Member, error) {
+	URL := fmt.Sprintf(c.endpointBase+unmuteMembershipEndpoint, groupID)
+
+	httpReq, err := http.NewRequest("POST", URL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp Member
+	err = c.doWithAuthToken(ctx, httpReq, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
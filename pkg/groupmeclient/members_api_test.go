@@ -0,0 +1,195 @@
+package groupmeclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestClient(t *testing.T, handler http.Handler) *Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return NewClient("token", WithAPIBase(server.URL))
+}
+
+func writeResponse(t *testing.T, w http.ResponseWriter, code int, response any) {
+	t.Helper()
+	w.WriteHeader(code)
+	err := json.NewEncoder(w).Encode(map[string]any{
+		"response": response,
+		"meta":     Meta{Code: HTTPStatusCode(code)},
+	})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAddMembers(t *testing.T) {
+	var got struct {
+		Members []*Member `json:"members"`
+	}
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/groups/1/members/add" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if token := r.URL.Query().Get("token"); token != "token" {
+			t.Errorf("unexpected token %q", token)
+		}
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Error(err)
+		}
+		writeResponse(t, w, 202, map[string]string{"results_id": "results"})
+	}))
+
+	resultsID, err := client.AddMembers(context.Background(), "1", &Member{Nickname: "Mom", UserID: "2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resultsID != "results" {
+		t.Errorf("resultsID = %q, want %q", resultsID, "results")
+	}
+	if len(got.Members) != 1 || got.Members[0].UserID != "2" || got.Members[0].GUID == "" {
+		t.Errorf("unexpected members sent: %v", got.Members)
+	}
+}
+
+// shortenPollInterval makes MemberResults poll quickly for the duration of a test
+func shortenPollInterval(t *testing.T) {
+	t.Helper()
+	pollInterval := memberResultsPollInterval
+	memberResultsPollInterval = time.Millisecond
+	t.Cleanup(func() {
+		memberResultsPollInterval = pollInterval
+	})
+}
+
+func TestMemberResultsPolls(t *testing.T) {
+	shortenPollInterval(t)
+	calls := 0
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/groups/1/members/results/results" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		writeResponse(t, w, 200, map[string]any{"members": []*Member{{ID: "3", UserID: "2"}}})
+	}))
+
+	members, err := client.MemberResults(context.Background(), "1", "results", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 3 {
+		t.Errorf("calls = %d, want 3", calls)
+	}
+	if len(members) != 1 || members[0].ID != "3" {
+		t.Errorf("unexpected members: %v", members)
+	}
+}
+
+func TestMemberResultsTimeout(t *testing.T) {
+	shortenPollInterval(t)
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+
+	_, err := client.MemberResults(context.Background(), "1", "results", 20*time.Millisecond)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestMemberResultsExpired(t *testing.T) {
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+
+	_, err := client.MemberResults(context.Background(), "1", "results", time.Second)
+	if !errors.Is(err, ErrMemberResultsExpired) {
+		t.Errorf("err = %v, want %v", err, ErrMemberResultsExpired)
+	}
+}
+
+func TestRemoveMember(t *testing.T) {
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/groups/1/members/3/remove" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		writeResponse(t, w, 200, nil)
+	}))
+
+	if err := client.RemoveMember(context.Background(), "1", "3"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUpdateMembership(t *testing.T) {
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/groups/1/memberships/update" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		var got struct {
+			Membership struct {
+				Nickname string `json:"nickname"`
+			} `json:"membership"`
+		}
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Error(err)
+		}
+		writeResponse(t, w, 200, Member{ID: "3", Nickname: got.Membership.Nickname})
+	}))
+
+	member, err := client.UpdateMembership(context.Background(), "1", "Dad")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if member.Nickname != "Dad" {
+		t.Errorf("nickname = %q, want %q", member.Nickname, "Dad")
+	}
+}
+
+func TestMuteMembershipRoundsUp(t *testing.T) {
+	tests := []struct {
+		duration time.Duration
+		want     int
+	}{
+		{0, 0},
+		{30 * time.Second, 1},
+		{time.Minute, 1},
+		{90 * time.Second, 2},
+		{time.Hour, 60},
+	}
+	for _, test := range tests {
+		client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != "POST" || r.URL.Path != "/groups/1/memberships/mute" {
+				t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			}
+			var got struct {
+				Duration int `json:"duration"`
+			}
+			body, _ := io.ReadAll(r.Body)
+			if err := json.Unmarshal(body, &got); err != nil {
+				t.Error(err)
+			}
+			if got.Duration != test.want {
+				t.Errorf("duration of %s = %d minutes, want %d", test.duration, got.Duration, test.want)
+			}
+			writeResponse(t, w, 200, Member{ID: "3"})
+		}))
+
+		if _, err := client.MuteMembership(context.Background(), "1", test.duration); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
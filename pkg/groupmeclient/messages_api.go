@@ -71,7 +71,7 @@ after the since_id message, using this parameter will omit the
 messages that immediately follow the given message. This is a
 bit counterintuitive, so take care.
 If no messages are found (e.g. when filtering with before_id)
-we return code 304.
+GroupMe returns code 304, which results in an empty response.
 Note that for historical reasons, likes are returned as an
 array of user ids in the favorited_by key.
 */
@@ -144,6 +144,8 @@ func (c *Client) CreateMessage(ctx context.Context, groupID ID, m *Message) (*Me
 	if err != nil {
 		return nil, err
 	}
+	// GroupMe drops messages with a SourceGUID it has already seen, so sending it again is safe
+	httpReq = setRetryable(httpReq, true)
 
 	var resp struct {
 		*Message `json:"message"`
@@ -0,0 +1,64 @@
+// Package groupme defines a client capable of executing API commands for the GroupMe chat service
+package groupmeclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// GroupMe documentation does not cover this endpoint, it is what the web client uses
+
+/*//////// Endpoints ////////*/
+const (
+	readReceiptsEndpointRoot = "/read_receipts"
+
+	createReadReceiptEndpoint = readReceiptsEndpointRoot // POST
+)
+
+/*//////// API Requests ////////*/
+
+/*
+CreateReadReceipt -
+
+Marks a conversation as read up to and including the message.
+
+Parameters:
+
+	chatID - required, ID(string); the group ID or the direct message conversation ID
+	messageID - required, ID(string)
+*/
+func (c *Client) CreateReadReceipt(ctx context.Context, chatID, messageID ID) (*ReadReceipt, error) {
+	URL := fmt.Sprintf(c.endpointBase + createReadReceiptEndpoint)
+
+	var data = struct {
+		ReadReceipt ReadReceipt `json:"read_receipt"`
+	}{
+		ReadReceipt{
+			ChatID:    chatID,
+			MessageID: messageID,
+		},
+	}
+
+	jsonBytes, err := json.Marshal(&data)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequest("POST", URL, bytes.NewBuffer(jsonBytes))
+	if err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		*ReadReceipt `json:"read_receipt"`
+	}
+	err = c.doWithAuthToken(ctx, httpReq, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.ReadReceipt, nil
+}
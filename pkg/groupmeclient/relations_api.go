@@ -9,6 +9,7 @@ import (
 // GroupMe documentation does not cover this "v4" endpoint
 // I don't know how else you're supposed to get your contact list
 const (
+	// Overridable with WithAPIBaseV4
 	GroupMeAPIBaseV4         = GroupMeAPIPath + "v4"
 	relationshipEndpointRoot = "/relationships"
 )
@@ -22,7 +23,7 @@ type RelationsQuery struct {
 // IndexRelations - Returns a paginated list of relations (users)
 // sorted by "updated_at"
 func (c *Client) IndexRelations(ctx context.Context, relationsQuery *RelationsQuery) ([]*User, error) {
-	httpReq, err := http.NewRequest("GET", GroupMeAPIBaseV4+relationshipEndpointRoot, nil)
+	httpReq, err := http.NewRequest("GET", c.endpointBaseV4+relationshipEndpointRoot, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,213 @@
+// Package groupme defines a client capable of executing API commands for the GroupMe chat service
+package groupmeclient
+
+import (
+	"context"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+/*//////// Rate Limiting ////////*/
+
+// GroupMe doesn't document its limits, these keep bursts (e.g. resyncing every group) below
+// the point where it starts answering with 420 Enhance Your Calm
+var (
+	requestsPerSecond = 5.0
+	requestBurst      = 10
+)
+
+// rateLimiter is a token bucket, every Client has its own so it goes away with the Client
+type rateLimiter struct {
+	lock   sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{tokens: float64(requestBurst), last: time.Now()}
+}
+
+// wait blocks until a request may be sent, or the context is cancelled
+func (l *rateLimiter) wait(ctx context.Context) error {
+	l.lock.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * requestsPerSecond
+	if l.tokens > float64(requestBurst) {
+		l.tokens = float64(requestBurst)
+	}
+	l.last = now
+	// Taking the token up front reserves the next free slot even if it has to be waited for
+	l.tokens--
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / requestsPerSecond * float64(time.Second))
+	}
+	l.lock.Unlock()
+
+	if delay == 0 {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(delay):
+		return nil
+	}
+}
+
+/*//////// Retries ////////*/
+
+// Backoff for responses that are worth retrying, the actual delay is jittered between 0 and the limit
+var (
+	maxRetries      = 4
+	retryBaseDelay  = time.Second
+	retryMaxDelay   = 30 * time.Second
+	retryAfterLimit = 5 * time.Minute
+)
+
+type retryableKey struct{}
+
+// setRetryable overrides whether a request may be sent again after a 420/429/502/503.
+// POSTs are only safe to repeat when GroupMe deduplicates them, i.e. messages with a SourceGUID.
+func setRetryable(req *http.Request, retryable bool) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), retryableKey{}, retryable))
+}
+
+func isRetryable(req *http.Request) bool {
+	if retryable, ok := req.Context().Value(retryableKey{}).(bool); ok {
+		return retryable
+	}
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+func shouldRetry(statusCode int) bool {
+	switch HTTPStatusCode(statusCode) {
+	case HTTPEnhanceYourCalm, HTTPTooManyRequests, HTTPBadGateway, HTTPServiceUnavailable:
+		return true
+	default:
+		return false
+	}
+}
+
+// retryDelay honours Retry-After, falling back to exponential backoff with full jitter
+func retryDelay(resp *http.Response, attempt int) time.Duration {
+	if retryAfter := parseRetryAfter(resp.Header.Get("Retry-After")); retryAfter > 0 {
+		return min(retryAfter, retryAfterLimit)
+	}
+	limit := min(retryBaseDelay<<attempt, retryMaxDelay)
+	return rand.N(limit) + 1
+}
+
+// parseRetryAfter supports both forms of the header, seconds and an HTTP date
+func parseRetryAfter(retryAfter string) time.Duration {
+	if retryAfter == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(retryAfter); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(retryAfter); err == nil {
+		return time.Until(date)
+	}
+	return 0
+}
+
+// rewindBody resets the body of a request so it can be sent again
+func rewindBody(req *http.Request) error {
+	if req.Body == nil || req.GetBody == nil {
+		return nil
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return err
+	}
+	req.Body = body
+	return nil
+}
+
+/*//////// Conditional Requests ////////*/
+
+type conditionalKey struct{}
+
+// setConditional makes a GET send the validators of its last response, so an
+// unchanged listing comes back as an empty 304 and is served from the cache instead
+func setConditional(req *http.Request) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), conditionalKey{}, true))
+}
+
+func isConditional(req *http.Request) bool {
+	conditional, _ := req.Context().Value(conditionalKey{}).(bool)
+	return conditional && req.Method == http.MethodGet
+}
+
+type cachedResponse struct {
+	etag         string
+	lastModified string
+	body         []byte
+}
+
+// conditionalCache keeps the last response of every conditional request, keyed by URL
+type conditionalCache struct {
+	lock      sync.Mutex
+	responses map[string]*cachedResponse
+}
+
+func newConditionalCache() *conditionalCache {
+	return &conditionalCache{responses: make(map[string]*cachedResponse)}
+}
+
+func (cc *conditionalCache) get(req *http.Request) *cachedResponse {
+	if cc == nil {
+		return nil
+	}
+	cc.lock.Lock()
+	defer cc.lock.Unlock()
+	return cc.responses[redactURL(req.URL)]
+}
+
+// prepare adds the validators of the cached response to the request
+func (cc *conditionalCache) prepare(req *http.Request) {
+	cached := cc.get(req)
+	if cached == nil {
+		return
+	}
+	if cached.etag != "" {
+		req.Header.Set("If-None-Match", cached.etag)
+	}
+	if cached.lastModified != "" {
+		req.Header.Set("If-Modified-Since", cached.lastModified)
+	}
+}
+
+// cached returns the body of the response a 304 refers to
+func (cc *conditionalCache) cached(req *http.Request) []byte {
+	if cached := cc.get(req); cached != nil {
+		return cached.body
+	}
+	return nil
+}
+
+func (cc *conditionalCache) store(resp *http.Response, body []byte) {
+	if cc == nil {
+		return
+	}
+	etag, lastModified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	if etag == "" && lastModified == "" {
+		return
+	}
+	cc.lock.Lock()
+	defer cc.lock.Unlock()
+	cc.responses[redactURL(resp.Request.URL)] = &cachedResponse{
+		etag:         etag,
+		lastModified: lastModified,
+		body:         body,
+	}
+}
@@ -0,0 +1,147 @@
+package groupmeclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// shortenRetries makes backoff quick for the duration of a test
+func shortenRetries(t *testing.T) {
+	t.Helper()
+	baseDelay, maxDelay, afterLimit := retryBaseDelay, retryMaxDelay, retryAfterLimit
+	retryBaseDelay, retryMaxDelay, retryAfterLimit = time.Millisecond, time.Millisecond, 100*time.Millisecond
+	t.Cleanup(func() {
+		retryBaseDelay, retryMaxDelay, retryAfterLimit = baseDelay, maxDelay, afterLimit
+	})
+}
+
+func TestRetryAfterTooManyRequests(t *testing.T) {
+	shortenRetries(t)
+	var requests atomic.Int32
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			writeResponse(t, w, 429, nil)
+			return
+		}
+		writeResponse(t, w, 200, Group{ID: "1"})
+	}))
+
+	start := time.Now()
+	group, err := client.ShowGroup(context.Background(), "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if group.ID != "1" {
+		t.Errorf("group ID = %q, want %q", group.ID, "1")
+	}
+	if requests.Load() != 2 {
+		t.Errorf("%d requests, want 2", requests.Load())
+	}
+	// Retry-After is capped by retryAfterLimit, but still waited for instead of the shorter backoff
+	if elapsed := time.Since(start); elapsed < retryAfterLimit {
+		t.Errorf("retried after %s, want at least %s", elapsed, retryAfterLimit)
+	}
+}
+
+func TestRetryServerErrorOnGet(t *testing.T) {
+	shortenRetries(t)
+	var requests atomic.Int32
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch requests.Add(1) {
+		case 1:
+			writeResponse(t, w, 502, nil)
+		case 2:
+			writeResponse(t, w, 503, nil)
+		default:
+			writeResponse(t, w, 200, Group{ID: "1"})
+		}
+	}))
+
+	if _, err := client.ShowGroup(context.Background(), "1"); err != nil {
+		t.Fatal(err)
+	}
+	if requests.Load() != 3 {
+		t.Errorf("%d requests, want 3", requests.Load())
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	shortenRetries(t)
+	var requests atomic.Int32
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		writeResponse(t, w, 429, nil)
+	}))
+
+	if _, err := client.ShowGroup(context.Background(), "1"); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("ShowGroup() = %v, want ErrRateLimited", err)
+	}
+	if requests.Load() != int32(maxRetries+1) {
+		t.Errorf("%d requests, want %d", requests.Load(), maxRetries+1)
+	}
+}
+
+func TestNoRetryOnPost(t *testing.T) {
+	shortenRetries(t)
+	var requests atomic.Int32
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		writeResponse(t, w, 503, nil)
+	}))
+
+	// Removing a member has no SourceGUID GroupMe could deduplicate it by
+	if err := client.RemoveMember(context.Background(), "1", "3"); err == nil {
+		t.Fatal("RemoveMember() = nil, want an error")
+	}
+	if requests.Load() != 1 {
+		t.Errorf("%d requests, want 1", requests.Load())
+	}
+}
+
+func TestNotModifiedServedFromCache(t *testing.T) {
+	var ifNoneMatch []string
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ifNoneMatch = append(ifNoneMatch, r.Header.Get("If-None-Match"))
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(int(HTTPNotModified))
+			return
+		}
+		writeResponse(t, w, 200, []*Group{{ID: "1", Name: "Group"}})
+	}))
+
+	for range 2 {
+		groups, err := client.IndexGroups(context.Background(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(groups) != 1 || groups[0].ID != "1" || groups[0].Name != "Group" {
+			t.Errorf("IndexGroups() = %v, want the cached group", groups)
+		}
+	}
+	if len(ifNoneMatch) != 2 || ifNoneMatch[0] != "" || ifNoneMatch[1] != `"v1"` {
+		t.Errorf("sent If-None-Match %q, want none and then the ETag", ifNoneMatch)
+	}
+}
+
+func TestNotModifiedWithoutCacheIsEmpty(t *testing.T) {
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") != "" {
+			t.Error("sent If-None-Match on a request that isn't conditional")
+		}
+		w.WriteHeader(int(HTTPNotModified))
+	}))
+
+	messages, err := client.IndexMessages(context.Background(), "1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages.Messages) != 0 {
+		t.Errorf("IndexMessages() = %v, want no messages", messages.Messages)
+	}
+}
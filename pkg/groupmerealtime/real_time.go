@@ -3,6 +3,7 @@ package groupmerealtime
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log"
 	"strings"
 	"sync"
@@ -26,6 +27,10 @@ const (
 var (
 	ErrHandlerNotFound    = errors.New("Handler not found")
 	ErrListenerNotStarted = errors.New("GroupMe listener not started")
+	// ErrUnauthorized is passed to HandleError when the push server rejects the access token
+	ErrUnauthorized = errors.New("GroupMe push server rejected the access token")
+	// ErrReconnectFailed is passed to HandleError when the reconnect policy gave up on the push server
+	ErrReconnectFailed = errors.New("GroupMe push server reconnect failed")
 )
 
 var concur = sync.Mutex{}
@@ -39,9 +44,12 @@ func init() {
 
 type HandlerAll interface {
 	Handler
+	HandlerConnection
+	HandlerReconnect
 
 	//of self
 	HandlerText
+	HandlerReadReceipt
 	HandlerLike
 	HandlerMembership
 
@@ -55,13 +63,27 @@ type HandlerAll interface {
 	HandleMemberNewNickname
 	HandleMemberNewAvatar
 	HandleMembers
+	HandleMemberRemoved
+	HandleMemberRoles
 }
 type Handler interface {
 	HandleError(error)
 }
+type HandlerConnection interface {
+	//HandleConnectionEvent is called when the connection to the push server changes
+	HandleConnectionEvent(event faye.ConnectionEvent, err error)
+}
+type HandlerReconnect interface {
+	//HandleReconnectAttempt is called before every retry to connect to the push server, after waiting for delay.
+	//err is why the previous attempt failed.
+	HandleReconnectAttempt(retry int, delay time.Duration, err error)
+}
 type HandlerText interface {
 	HandleTextMessage(groupmeclient.Message)
 }
+type HandlerReadReceipt interface {
+	HandleReadReceipt(groupmeclient.ReadReceipt)
+}
 type HandlerLike interface {
 	HandleLike(groupmeclient.Message)
 }
@@ -96,6 +118,14 @@ type HandleMembers interface {
 	//HandleNewMembers returns only partial member with id and nickname; added is false if removing
 	HandleMembers(group groupmeclient.ID, members []groupmeclient.Member, added bool)
 }
+type HandleMemberRoles interface {
+	//HandleMemberRoles returns the full set of roles the member now has in the group
+	HandleMemberRoles(group groupmeclient.ID, user groupmeclient.ID, roles []groupmeclient.MemberRole)
+}
+type HandleMemberRemoved interface {
+	//HandleMemberRemoved returns only partial members with id and nickname; remover is nil if the member left on their own
+	HandleMemberRemoved(group groupmeclient.ID, removed groupmeclient.Member, remover *groupmeclient.Member)
+}
 
 type PushMessage interface {
 	Channel() string
@@ -107,15 +137,26 @@ type PushMessage interface {
 // PushSubscription manages real time subscription
 type PushSubscription struct {
 	channel           chan PushMessage
+	ctx               context.Context
+	cancel            context.CancelFunc
+	goroutines        *sync.WaitGroup
 	fayeClient        *faye.FayeClient
 	handlers          []Handler
+	reconnectPolicy   ReconnectPolicy
 	connectionTimeout int64
 	timeoutMinutes    int64
 }
 
 func NewFayeClient(logger faye.Logger, authToken string) *faye.FayeClient {
+	return NewFayeClientForServer(logger, PushServer, authToken)
+}
+
+// NewFayeClientForServer connects to another push server than GroupMe's, e.g. a local stand-in.
+// The server may be given with an http(s) scheme, which the websocket transport maps to ws(s).
+// Without one the websocket transport connects over ws:// and long-polling over https://.
+func NewFayeClientForServer(logger faye.Logger, server string, authToken string) *faye.FayeClient {
 	fc := faye.NewFayeClient(
-		PushServer,
+		server,
 		handshakeChannel,
 		connectChannel,
 		subscribeChannel,
@@ -130,13 +171,24 @@ func NewFayeClient(logger faye.Logger, authToken string) *faye.FayeClient {
 }
 
 // NewPushSubscription creates and returns a push subscription object
-func NewPushSubscription(context context.Context) PushSubscription {
+func NewPushSubscription(ctx context.Context) PushSubscription {
+	// The subscription outlives the context it's created in, it lasts until Stop
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
 	return PushSubscription{
-		channel:        make(chan PushMessage),
-		timeoutMinutes: 3,
+		channel:         make(chan PushMessage),
+		ctx:             ctx,
+		cancel:          cancel,
+		goroutines:      &sync.WaitGroup{},
+		reconnectPolicy: DefaultReconnectPolicy,
+		timeoutMinutes:  3,
 	}
 }
 
+// SetReconnectPolicy changes how the subscription reconnects to the push server, must be called before Setup
+func (r *PushSubscription) SetReconnectPolicy(policy ReconnectPolicy) {
+	r.reconnectPolicy = policy
+}
+
 func (r *PushSubscription) AddHandler(h Handler) {
 	r.handlers = append(r.handlers, h)
 }
@@ -150,7 +202,13 @@ var RealTimeHandlers map[string]func(r *PushSubscription, channel string, data .
 var RealTimeSystemHandlers map[string]func(r *PushSubscription, channel string, id groupmeclient.ID, rawData []byte)
 
 func (r *PushSubscription) HandleMessageLoop() {
-	for msg := range r.channel {
+	for {
+		var msg PushMessage
+		select {
+		case <-r.ctx.Done():
+			return
+		case msg = <-r.channel:
+		}
 		r.connectionTimeout = time.Now().Unix() + (60 * r.timeoutMinutes)
 		data := msg.Data()
 		content := data["subject"]
@@ -176,61 +234,176 @@ func (r *PushSubscription) HandleMessageLoop() {
 	}
 }
 
-func (r *PushSubscription) Setup(context context.Context, client faye.FayeClient) error {
-	r.fayeClient = &client
-	if err := r.fayeClient.HandshakeAndConnect(); err != nil {
+func (r *PushSubscription) Setup(ctx context.Context, client *faye.FayeClient) error {
+	r.fayeClient = client
+	r.fayeClient.SetAuthFailureHandler(r.handleAuthFailure)
+	r.fayeClient.SetConnectionEventHandler(r.handleConnectionEvent)
+	if err := r.connect(ctx); err != nil {
 		return err
 	}
 
-	go r.HandleMessageLoop()
-	go r.StayConnectedLoop()
+	r.goroutines.Add(2)
+	go func() {
+		defer r.goroutines.Done()
+		r.HandleMessageLoop()
+	}()
+	go func() {
+		defer r.goroutines.Done()
+		r.StayConnectedLoop()
+	}()
 	return nil
 }
 
+// Stop ends the message and reconnect loops and closes the faye client, no more events are passed to the handlers after this
+func (r *PushSubscription) Stop() {
+	r.cancel()
+	if r.fayeClient != nil {
+		r.fayeClient.Close()
+	}
+}
+
+// Close disconnects from the push server and waits until every goroutine of the subscription stopped,
+// or ctx is done. It must not be called from a handler, since the handlers run on those goroutines.
+func (r *PushSubscription) Close(ctx context.Context) error {
+	r.cancel()
+	var err error
+	if r.fayeClient != nil {
+		err = r.fayeClient.Disconnect(ctx)
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		r.goroutines.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Stopped returns whether Stop was called, either directly or because the access token was rejected
+func (r *PushSubscription) Stopped() bool {
+	return r.ctx.Err() != nil
+}
+
+// Connected returns whether the push server connection is currently up
+func (r *PushSubscription) Connected() bool {
+	return r.fayeClient != nil && !r.Stopped() && r.fayeClient.Connected()
+}
+
+func (r *PushSubscription) handleConnectionEvent(event faye.ConnectionEvent, err error) {
+	if r.Stopped() {
+		return
+	}
+	for _, h := range r.handlers {
+		if h, ok := h.(HandlerConnection); ok {
+			h.HandleConnectionEvent(event, err)
+		}
+	}
+}
+
+// handleAuthFailure stops the loops, reconnecting can't succeed until the user logs in again.
+// It's called by the faye client's event loop, so the handlers run separately, they may Stop and wait for the client.
+func (r *PushSubscription) handleAuthFailure(err error) {
+	r.cancel()
+	r.goroutines.Add(1)
+	go func() {
+		defer r.goroutines.Done()
+		for _, h := range r.handlers {
+			h.HandleError(fmt.Errorf("%w: %w", ErrUnauthorized, err))
+		}
+	}()
+}
+
+// StayConnectedLoop reconnects whenever the connection is lost, until the reconnect policy gives up
 func (r *PushSubscription) StayConnectedLoop() {
-	time.Sleep(5 * time.Second)
-	for {
-		if !r.fayeClient.Connected() {
-			retries := 3
-			retry_wait_seconds := 5
-			reconnected := false
-			for i := range retries {
-				log.Println("PushSubscription reconnecting")
-				if err := r.fayeClient.HandshakeAndConnect(); err != nil {
-					log.Printf("PushSubscription could not reconnect on try %d (%s), retrying in %d seconds", i+1, err, retry_wait_seconds)
-					time.Sleep(time.Duration(retry_wait_seconds) * time.Second)
-					continue
-				}
-				reconnected = true
-				break
+	for r.sleep(5 * time.Second) {
+		if r.fayeClient.Connected() {
+			continue
+		}
+		log.Println("PushSubscription reconnecting")
+		if err := r.connect(r.ctx); err != nil {
+			if r.Stopped() {
+				return
 			}
-			if !reconnected {
-				log.Printf("PushSubscription could not reconnect after %d retries\n", retries)
-				break
+			log.Printf("PushSubscription stopped reconnecting: %s", err)
+			for _, h := range r.handlers {
+				h.HandleError(fmt.Errorf("%w: %w", ErrReconnectFailed, err))
 			}
-			// r.fayeClient.Resubscribe()
+			return
+		}
+	}
+}
+
+// connect retries to connect to the push server as the reconnect policy says, until it succeeds,
+// the policy gives up, or retrying can't help
+func (r *PushSubscription) connect(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	defer context.AfterFunc(r.ctx, cancel)()
+
+	for retry := 1; ; retry++ {
+		err := r.fayeClient.HandshakeAndConnect(ctx)
+		if err == nil {
+			return nil
+		} else if ctx.Err() != nil ||
+			errors.Is(err, faye.ErrUnauthorized) ||
+			errors.Is(err, faye.ErrClosed) ||
+			errors.Is(err, faye.ErrReconnectAdvisedAgainst) {
+			return err
+		} else if r.reconnectPolicy.givesUp(retry) {
+			return fmt.Errorf("gave up after %d retries: %w", retry-1, err)
 		}
-		time.Sleep(5 * time.Second)
+
+		delay := r.reconnectPolicy.Delay(retry)
+		log.Printf("PushSubscription could not connect (%s), retry %d in %s", err, retry, delay)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		r.handleReconnectAttempt(retry, delay, err)
+	}
+}
+
+func (r *PushSubscription) handleReconnectAttempt(retry int, delay time.Duration, err error) {
+	for _, h := range r.handlers {
+		if h, ok := h.(HandlerReconnect); ok {
+			h.HandleReconnectAttempt(retry, delay, err)
+		}
+	}
+}
+
+// sleep waits for d and returns false if the subscription was stopped in the meantime
+func (r *PushSubscription) sleep(d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-r.ctx.Done():
+		return false
 	}
 }
 
 // SubscribeToUser to users
-func (r *PushSubscription) SubscribeToUser(context context.Context, id groupmeclient.ID) error {
-	return r.subscribeWithPrefix(userChannel, id)
+func (r *PushSubscription) SubscribeToUser(ctx context.Context, id groupmeclient.ID) error {
+	return r.subscribeWithPrefix(ctx, userChannel, id)
 }
 
 // SubscribeToGroup to groups for typing notification
-func (r *PushSubscription) SubscribeToGroup(context context.Context, id groupmeclient.ID) error {
-	return r.subscribeWithPrefix(groupChannel, id)
+func (r *PushSubscription) SubscribeToGroup(ctx context.Context, id groupmeclient.ID) error {
+	return r.subscribeWithPrefix(ctx, groupChannel, id)
 }
 
 // SubscribeToDM to users
-func (r *PushSubscription) SubscribeToDM(context context.Context, id groupmeclient.ID) error {
+func (r *PushSubscription) SubscribeToDM(ctx context.Context, id groupmeclient.ID) error {
 	id = groupmeclient.ID(strings.Replace(id.String(), "+", "_", 1))
-	return r.subscribeWithPrefix(dmChannel, id)
+	return r.subscribeWithPrefix(ctx, dmChannel, id)
 }
 
-func (r *PushSubscription) subscribeWithPrefix(prefix string, groupID groupmeclient.ID) error {
+func (r *PushSubscription) subscribeWithPrefix(ctx context.Context, prefix string, groupID groupmeclient.ID) error {
 	concur.Lock()
 	defer concur.Unlock()
 	if r.fayeClient == nil {
@@ -239,13 +412,49 @@ func (r *PushSubscription) subscribeWithPrefix(prefix string, groupID groupmecli
 
 	channel := prefix + groupID.String()
 	c_new := make(chan faye.Message)
-	r.fayeClient.WaitSubscribe(channel, c_new)
+	if err := r.fayeClient.WaitSubscribe(ctx, channel, c_new); err != nil {
+		return err
+	}
 	//converting between types because channels don't support interfaces well
+	r.goroutines.Add(1)
 	go func() {
+		defer r.goroutines.Done()
 		for i := range c_new {
-			r.channel <- i
+			select {
+			case r.channel <- i:
+			case <-r.ctx.Done():
+				return
+			}
 		}
 	}()
 
 	return nil
 }
+
+// UnsubscribeUser stops the messages of a user subscribed with SubscribeToUser
+func (r *PushSubscription) UnsubscribeUser(ctx context.Context, id groupmeclient.ID) error {
+	return r.unsubscribeWithPrefix(ctx, userChannel, id)
+}
+
+// UnsubscribeGroup stops the messages of a group subscribed with SubscribeToGroup, e.g. after leaving it
+func (r *PushSubscription) UnsubscribeGroup(ctx context.Context, id groupmeclient.ID) error {
+	return r.unsubscribeWithPrefix(ctx, groupChannel, id)
+}
+
+// UnsubscribeDM stops the messages of a DM subscribed with SubscribeToDM
+func (r *PushSubscription) UnsubscribeDM(ctx context.Context, id groupmeclient.ID) error {
+	id = groupmeclient.ID(strings.Replace(id.String(), "+", "_", 1))
+	return r.unsubscribeWithPrefix(ctx, dmChannel, id)
+}
+
+// unsubscribeWithPrefix drops the subscription, the faye client closes its channel which ends the goroutine
+// started in subscribeWithPrefix
+func (r *PushSubscription) unsubscribeWithPrefix(ctx context.Context, prefix string, groupID groupmeclient.ID) error {
+	concur.Lock()
+	defer concur.Unlock()
+	if r.fayeClient == nil {
+		return ErrListenerNotStarted
+	}
+
+	return r.fayeClient.Unsubscribe(ctx, prefix+groupID.String())
+}
@@ -59,6 +59,18 @@ func init() {
 
 	RealTimeHandlers["line.create"] = RealTimeHandlers["direct_message.create"]
 
+	RealTimeHandlers["direct_message.read_receipt.create"] = func(r *PushSubscription, channel string, data ...interface{}) {
+		b, _ := json.Marshal(data[0])
+		out := groupmeclient.ReadReceipt{}
+		_ = json.Unmarshal(b, &out)
+
+		for _, h := range r.handlers {
+			if h, ok := h.(HandlerReadReceipt); ok {
+				h.HandleReadReceipt(out)
+			}
+		}
+	}
+
 	RealTimeHandlers["like.create"] = func(r *PushSubscription, channel string, data ...interface{}) { //should be an associated chatEvent
 	}
 
@@ -135,24 +147,53 @@ func init() {
 
 	RealTimeSystemHandlers["membership.announce.added"] = func(r *PushSubscription, channel string, id groupmeclient.ID, rawData []byte) {
 		data := struct {
-			Added []groupmeclient.Member `json:"added_users"`
+			Added []systemUser `json:"added_users"`
 		}{}
 		_ = json.Unmarshal(rawData, &data)
+		added := make([]groupmeclient.Member, 0, len(data.Added))
+		for _, user := range data.Added {
+			added = append(added, user.member())
+		}
 		for _, h := range r.handlers {
 			if h, ok := h.(HandleMembers); ok {
-				h.HandleMembers(id, data.Added, true)
+				h.HandleMembers(id, added, true)
 			}
 		}
 	}
 
 	RealTimeSystemHandlers["membership.notifications.removed"] = func(r *PushSubscription, channel string, id groupmeclient.ID, rawData []byte) {
 		data := struct {
-			Added groupmeclient.Member `json:"removed_user"`
+			Removed systemUser  `json:"removed_user"`
+			Remover *systemUser `json:"remover_user"`
+		}{}
+		_ = json.Unmarshal(rawData, &data)
+		var remover *groupmeclient.Member
+		if data.Remover != nil && data.Remover.ID != data.Removed.ID {
+			member := data.Remover.member()
+			remover = &member
+		}
+		r.handleMemberRemoved(id, data.Removed.member(), remover)
+	}
+
+	RealTimeSystemHandlers["membership.notifications.exited"] = func(r *PushSubscription, channel string, id groupmeclient.ID, rawData []byte) {
+		data := struct {
+			Removed systemUser `json:"removed_user"`
+		}{}
+		_ = json.Unmarshal(rawData, &data)
+		r.handleMemberRemoved(id, data.Removed.member(), nil)
+	}
+
+	RealTimeSystemHandlers["group.role_change_admin"] = func(r *PushSubscription, channel string, id groupmeclient.ID, rawData []byte) {
+		data := struct {
+			Member struct {
+				systemUser
+				Roles []groupmeclient.MemberRole `json:"roles"`
+			} `json:"member"`
 		}{}
 		_ = json.Unmarshal(rawData, &data)
 		for _, h := range r.handlers {
-			if h, ok := h.(HandleMembers); ok {
-				h.HandleMembers(id, []groupmeclient.Member{data.Added}, false)
+			if h, ok := h.(HandleMemberRoles); ok {
+				h.HandleMemberRoles(id, groupmeclient.ID(data.Member.ID.String()), data.Member.Roles)
 			}
 		}
 	}
@@ -237,3 +278,27 @@ func init() {
 		}
 	}
 }
+
+// systemUser is how users are referenced in system events, with a numeric id
+type systemUser struct {
+	ID       json.Number `json:"id"`
+	Nickname string      `json:"nickname"`
+}
+
+func (u systemUser) member() groupmeclient.Member {
+	return groupmeclient.Member{
+		UserID:   groupmeclient.ID(u.ID.String()),
+		Nickname: u.Nickname,
+	}
+}
+
+// handleMemberRemoved falls back to HandleMembers for handlers that can't tell a leave from a kick
+func (r *PushSubscription) handleMemberRemoved(id groupmeclient.ID, removed groupmeclient.Member, remover *groupmeclient.Member) {
+	for _, h := range r.handlers {
+		if h, ok := h.(HandleMemberRemoved); ok {
+			h.HandleMemberRemoved(id, removed, remover)
+		} else if h, ok := h.(HandleMembers); ok {
+			h.HandleMembers(id, []groupmeclient.Member{removed}, false)
+		}
+	}
+}
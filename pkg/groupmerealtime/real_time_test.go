@@ -0,0 +1,83 @@
+package groupmerealtime_test
+
+import (
+	"context"
+	"runtime"
+	"runtime/pprof"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GroveJay/matrix-groupme-bridge/pkg/groupmeclient"
+	"github.com/GroveJay/matrix-groupme-bridge/pkg/groupmerealtime"
+	"github.com/GroveJay/matrix-groupme-bridge/pkg/groupmetest"
+	"github.com/rs/zerolog"
+)
+
+const testToken = "token"
+
+type errorHandler struct {
+	t *testing.T
+}
+
+func (h errorHandler) HandleError(err error) {
+	h.t.Errorf("HandleError(%v)", err)
+}
+
+func connectAndClose(ctx context.Context, t *testing.T, server *groupmetest.Server) {
+	t.Helper()
+	subscription := groupmerealtime.NewPushSubscription(ctx)
+	subscription.AddHandler(errorHandler{t: t})
+	logger := groupmerealtime.FayeZeroLogger{Logger: zerolog.Nop()}
+	if err := subscription.Setup(ctx, groupmerealtime.NewFayeClientForServer(logger, server.PushServer(), testToken)); err != nil {
+		t.Fatal(err)
+	}
+	if err := subscription.SubscribeToUser(ctx, "1"); err != nil {
+		t.Fatal(err)
+	} else if err := subscription.SubscribeToGroup(ctx, "10"); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.WaitForSubscription(ctx, "/group/10"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := subscription.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// The fake forgets clients on /meta/disconnect, which it handles after the websocket was closed
+	for server.Subscribed("/user/1") || server.Subscribed("/group/10") {
+		select {
+		case <-time.After(10 * time.Millisecond):
+		case <-ctx.Done():
+			t.Fatal("push server still has subscriptions after Close")
+		}
+	}
+	if subscription.Connected() {
+		t.Error("Connected() = true after Close")
+	}
+}
+
+func TestCloseStopsGoroutines(t *testing.T) {
+	server := groupmetest.NewServer(testToken, &groupmeclient.User{ID: "1", Name: "Me"})
+	defer server.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	// The first cycle starts goroutines that stay around on purpose, e.g. the timer goroutine of the runtime
+	connectAndClose(ctx, t, server)
+	baseline := runtime.NumGoroutine()
+	for range 3 {
+		connectAndClose(ctx, t, server)
+	}
+
+	// Closing the connections ends the server's goroutines for them shortly after
+	for runtime.NumGoroutine() > baseline {
+		select {
+		case <-time.After(10 * time.Millisecond):
+		case <-ctx.Done():
+			var stacks strings.Builder
+			_ = pprof.Lookup("goroutine").WriteTo(&stacks, 1)
+			t.Fatalf("%d goroutines after the cycles, %d before:\n%s", runtime.NumGoroutine(), baseline, stacks.String())
+		}
+	}
+}
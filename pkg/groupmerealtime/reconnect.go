@@ -0,0 +1,55 @@
+package groupmerealtime
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// ReconnectPolicy decides how long to wait between attempts to connect to the push server
+type ReconnectPolicy struct {
+	// InitialDelay is the wait before the first retry, it doubles with every failed attempt
+	InitialDelay time.Duration
+	// MaxDelay caps the wait between attempts, jitter included
+	MaxDelay time.Duration
+	// Jitter randomizes every wait by up to this fraction of it, so clients that lost the
+	// connection at the same time don't all come back at once. It is clamped to [0, 1], and
+	// a wait never drops below half of InitialDelay.
+	Jitter float64
+	// MaxRetries is the number of retries after which to give up, 0 retries forever
+	MaxRetries int
+}
+
+// DefaultReconnectPolicy retries forever, backing off from a second up to five minutes
+var DefaultReconnectPolicy = ReconnectPolicy{
+	InitialDelay: time.Second,
+	MaxDelay:     5 * time.Minute,
+	Jitter:       0.2,
+}
+
+// Delay returns how long to wait before the given retry, counting from 1
+func (p ReconnectPolicy) Delay(retry int) time.Duration {
+	initialDelay, maxDelay := p.InitialDelay, p.MaxDelay
+	if initialDelay <= 0 {
+		initialDelay = DefaultReconnectPolicy.InitialDelay
+	}
+	if maxDelay <= 0 {
+		maxDelay = DefaultReconnectPolicy.MaxDelay
+	}
+
+	delay := initialDelay
+	for i := 1; i < retry && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	delay = min(delay, maxDelay)
+	// Beyond 1 the jitter could make the wait negative
+	if jitter := min(p.Jitter, 1); jitter > 0 {
+		delay += time.Duration((rand.Float64()*2 - 1) * jitter * float64(delay))
+	}
+	// The floor keeps a full jitter from retrying immediately, the cap applies to the jittered wait
+	return min(max(delay, initialDelay/2), maxDelay)
+}
+
+// givesUp returns whether there should be no more retries after the given one
+func (p ReconnectPolicy) givesUp(retry int) bool {
+	return p.MaxRetries > 0 && retry > p.MaxRetries
+}
@@ -0,0 +1,75 @@
+package groupmerealtime
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReconnectPolicyDelay(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   ReconnectPolicy
+		retry    int
+		min, max time.Duration
+	}{
+		{"first retry", ReconnectPolicy{InitialDelay: time.Second, MaxDelay: time.Minute}, 1, time.Second, time.Second},
+		{"doubles", ReconnectPolicy{InitialDelay: time.Second, MaxDelay: time.Minute}, 4, 8 * time.Second, 8 * time.Second},
+		{"capped", ReconnectPolicy{InitialDelay: time.Second, MaxDelay: time.Minute}, 10, time.Minute, time.Minute},
+		{"capped without overflowing", ReconnectPolicy{InitialDelay: time.Second, MaxDelay: time.Minute}, 1000, time.Minute, time.Minute},
+		{"defaults", ReconnectPolicy{}, 1, DefaultReconnectPolicy.InitialDelay, DefaultReconnectPolicy.InitialDelay},
+		{"jitter", ReconnectPolicy{InitialDelay: 10 * time.Second, MaxDelay: time.Minute, Jitter: 0.5}, 1, 5 * time.Second, 15 * time.Second},
+		{"jitter of capped delay", ReconnectPolicy{InitialDelay: time.Second, MaxDelay: time.Minute, Jitter: 0.5}, 10, 30 * time.Second, time.Minute},
+		{"jitter clamped to 1", ReconnectPolicy{InitialDelay: 10 * time.Second, MaxDelay: time.Minute, Jitter: 5}, 1, 5 * time.Second, 20 * time.Second},
+		{"negative jitter ignored", ReconnectPolicy{InitialDelay: 10 * time.Second, MaxDelay: time.Minute, Jitter: -1}, 1, 10 * time.Second, 10 * time.Second},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Jitter is random, so check the bounds a number of times
+			for range 100 {
+				if delay := test.policy.Delay(test.retry); delay < test.min || delay > test.max {
+					t.Fatalf("Delay(%d) = %s, want between %s and %s", test.retry, delay, test.min, test.max)
+				}
+			}
+		})
+	}
+}
+
+func TestReconnectPolicyDelayBounds(t *testing.T) {
+	policies := []ReconnectPolicy{
+		DefaultReconnectPolicy,
+		{InitialDelay: time.Second, MaxDelay: time.Minute, Jitter: 1},
+		{InitialDelay: 10 * time.Second, MaxDelay: 15 * time.Second, Jitter: 0.5},
+		{InitialDelay: time.Minute, MaxDelay: time.Second, Jitter: 1},
+	}
+	for _, policy := range policies {
+		for retry := 1; retry <= 30; retry++ {
+			for range 100 {
+				if delay := policy.Delay(retry); delay <= 0 || delay > policy.MaxDelay {
+					t.Fatalf("Delay(%d) with %+v = %s, want above 0 and at most %s", retry, policy, delay, policy.MaxDelay)
+				}
+			}
+		}
+	}
+}
+
+func TestReconnectPolicyGivesUp(t *testing.T) {
+	tests := []struct {
+		maxRetries int
+		retry      int
+		givesUp    bool
+	}{
+		{0, 1, false},
+		{0, 1000, false},
+		{3, 1, false},
+		{3, 3, false},
+		{3, 4, true},
+		{1, 1, false},
+		{1, 2, true},
+	}
+	for _, test := range tests {
+		policy := ReconnectPolicy{MaxRetries: test.maxRetries}
+		if givesUp := policy.givesUp(test.retry); givesUp != test.givesUp {
+			t.Errorf("givesUp(%d) with MaxRetries %d = %t, want %t", test.retry, test.maxRetries, givesUp, test.givesUp)
+		}
+	}
+}
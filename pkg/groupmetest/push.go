@@ -0,0 +1,411 @@
+package groupmetest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/GroveJay/matrix-groupme-bridge/pkg/groupmeclient"
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+)
+
+// How long a long-polling /meta/connect is held open when there is nothing to deliver
+var longPollTimeout = 5 * time.Second
+
+// bayeuxMessage is a message of the Bayeux protocol, in either direction
+type bayeuxMessage struct {
+	ID                       string         `json:"id,omitempty"`
+	Channel                  string         `json:"channel"`
+	ClientID                 string         `json:"clientId,omitempty"`
+	Successful               bool           `json:"successful,omitempty"`
+	Error                    string         `json:"error,omitempty"`
+	Version                  string         `json:"version,omitempty"`
+	SupportedConnectionTypes []string       `json:"supportedConnectionTypes,omitempty"`
+	ConnectionType           string         `json:"connectionType,omitempty"`
+	Subscription             string         `json:"subscription,omitempty"`
+	Data                     map[string]any `json:"data,omitempty"`
+	Ext                      map[string]any `json:"ext,omitempty"`
+	Advice                   map[string]any `json:"advice,omitempty"`
+}
+
+// wsConn serializes writes, since deliveries and replies are written from different goroutines
+type wsConn struct {
+	conn *websocket.Conn
+	lock sync.Mutex
+}
+
+func (c *wsConn) write(ctx context.Context, msgs []bayeuxMessage) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return wsjson.Write(ctx, c.conn, msgs)
+}
+
+type pushClient struct {
+	id            string
+	subscriptions map[string]bool
+	ws            *wsConn
+	// Messages waiting for the next long-polling /meta/connect
+	queue []bayeuxMessage
+	wake  chan struct{}
+}
+
+// pushServer is a minimal Bayeux server, speaking the parts of the protocol the faye client uses
+type pushServer struct {
+	s               *Server
+	lock            sync.Mutex
+	clients         map[string]*pushClient
+	sockets         map[*wsConn]bool
+	connectionTypes []string
+	// Refuses websocket upgrades while still offering them, like a proxy that doesn't let them through
+	websocketsBlocked bool
+	// Closed and replaced every time a subscription is added
+	subscribed chan struct{}
+	closed     chan struct{}
+	nextClient int
+	nextID     int
+}
+
+func newPushServer(s *Server) *pushServer {
+	return &pushServer{
+		s:               s,
+		clients:         make(map[string]*pushClient),
+		sockets:         make(map[*wsConn]bool),
+		connectionTypes: []string{"websocket", "long-polling"},
+		subscribed:      make(chan struct{}),
+		closed:          make(chan struct{}),
+	}
+}
+
+func (p *pushServer) close() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	select {
+	case <-p.closed:
+		return
+	default:
+		close(p.closed)
+	}
+	for socket := range p.sockets {
+		_ = socket.conn.CloseNow()
+	}
+}
+
+func (p *pushServer) handle(w http.ResponseWriter, r *http.Request) {
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		p.serveWebsocket(w, r)
+		return
+	} else if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	msgs, err := decodeBayeux(body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var replies []bayeuxMessage
+	for _, msg := range msgs {
+		if msg.Channel == "/meta/connect" {
+			replies = append(replies, p.longPoll(r.Context(), msg)...)
+		} else {
+			replies = append(replies, p.process(msg, nil))
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(replies)
+}
+
+func (p *pushServer) serveWebsocket(w http.ResponseWriter, r *http.Request) {
+	p.lock.Lock()
+	websocketAllowed := false
+	for _, connectionType := range p.connectionTypes {
+		websocketAllowed = websocketAllowed || connectionType == "websocket"
+	}
+	websocketAllowed = websocketAllowed && !p.websocketsBlocked
+	p.lock.Unlock()
+	if !websocketAllowed {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	conn, err := websocket.Accept(w, r, nil)
+	if err != nil {
+		return
+	}
+	socket := &wsConn{conn: conn}
+	p.lock.Lock()
+	p.sockets[socket] = true
+	p.lock.Unlock()
+	defer func() {
+		p.lock.Lock()
+		delete(p.sockets, socket)
+		for _, client := range p.clients {
+			if client.ws == socket {
+				client.ws = nil
+			}
+		}
+		p.lock.Unlock()
+		_ = conn.CloseNow()
+	}()
+
+	ctx := r.Context()
+	for {
+		_, body, err := conn.Read(ctx)
+		if err != nil {
+			return
+		}
+		msgs, err := decodeBayeux(body)
+		if err != nil {
+			return
+		}
+		for _, msg := range msgs {
+			if err := socket.write(ctx, []bayeuxMessage{p.process(msg, socket)}); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// decodeBayeux accepts both a single message and an array of messages
+func decodeBayeux(body []byte) ([]bayeuxMessage, error) {
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		var msgs []bayeuxMessage
+		err := json.Unmarshal(body, &msgs)
+		return msgs, err
+	}
+	var msg bayeuxMessage
+	err := json.Unmarshal(body, &msg)
+	return []bayeuxMessage{msg}, err
+}
+
+func reply(msg bayeuxMessage) bayeuxMessage {
+	return bayeuxMessage{ID: msg.ID, Channel: msg.Channel, ClientID: msg.ClientID, Successful: true}
+}
+
+func unknownClient(msg bayeuxMessage) bayeuxMessage {
+	resp := reply(msg)
+	resp.Successful = false
+	resp.Error = fmt.Sprintf("401:%s:Unknown client", msg.ClientID)
+	resp.Advice = map[string]any{"reconnect": "handshake", "interval": 0}
+	return resp
+}
+
+// process answers a message, socket is the websocket it arrived on or nil for long-polling
+func (p *pushServer) process(msg bayeuxMessage, socket *wsConn) bayeuxMessage {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if msg.Channel == "/meta/handshake" {
+		p.nextClient++
+		client := &pushClient{
+			id:            "fakeclient" + strconv.Itoa(p.nextClient),
+			subscriptions: make(map[string]bool),
+			wake:          make(chan struct{}, 1),
+		}
+		p.clients[client.id] = client
+		resp := reply(msg)
+		resp.ClientID = client.id
+		resp.Version = "1.0"
+		resp.SupportedConnectionTypes = p.connectionTypes
+		return resp
+	}
+
+	client, ok := p.clients[msg.ClientID]
+	if !ok {
+		return unknownClient(msg)
+	}
+	resp := reply(msg)
+	switch msg.Channel {
+	case "/meta/connect":
+		client.ws = socket
+	case "/meta/subscribe":
+		if token, _ := msg.Ext["access_token"].(string); token != p.s.Token {
+			resp.Successful = false
+			resp.Error = "401::Unauthorized"
+			break
+		}
+		resp.Subscription = msg.Subscription
+		client.subscriptions[msg.Subscription] = true
+		close(p.subscribed)
+		p.subscribed = make(chan struct{})
+	case "/meta/unsubscribe":
+		resp.Subscription = msg.Subscription
+		delete(client.subscriptions, msg.Subscription)
+	case "/meta/disconnect":
+		delete(p.clients, client.id)
+	}
+	// Anything else is a publish, e.g. the pings the client sends, which are only acknowledged
+	return resp
+}
+
+// longPoll answers a long-polling /meta/connect once there is something to deliver
+func (p *pushServer) longPoll(ctx context.Context, msg bayeuxMessage) []bayeuxMessage {
+	resp := p.process(msg, nil)
+	if !resp.Successful {
+		return []bayeuxMessage{resp}
+	}
+	p.lock.Lock()
+	client := p.clients[msg.ClientID]
+	p.lock.Unlock()
+
+	select {
+	case <-client.wake:
+	case <-ctx.Done():
+	case <-p.closed:
+	case <-time.After(longPollTimeout):
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	queued := client.queue
+	client.queue = nil
+	return append([]bayeuxMessage{resp}, queued...)
+}
+
+func subscriptionMatches(subscription, channel string) bool {
+	matched, _ := path.Match(subscription, channel)
+	return matched
+}
+
+// deliver sends a message to every client subscribed to the channel
+func (p *pushServer) deliver(channel string, data map[string]any) int {
+	p.lock.Lock()
+	var sockets []*wsConn
+	var msgs []bayeuxMessage
+	delivered := 0
+	for _, client := range p.clients {
+		subscribed := false
+		for subscription := range client.subscriptions {
+			subscribed = subscribed || subscriptionMatches(subscription, channel)
+		}
+		if !subscribed {
+			continue
+		}
+		p.nextID++
+		msg := bayeuxMessage{ID: strconv.Itoa(p.nextID), Channel: channel, ClientID: client.id, Data: data}
+		delivered++
+		if client.ws != nil {
+			sockets = append(sockets, client.ws)
+			msgs = append(msgs, msg)
+			continue
+		}
+		client.queue = append(client.queue, msg)
+		select {
+		case client.wake <- struct{}{}:
+		default:
+		}
+	}
+	p.lock.Unlock()
+
+	for i, socket := range sockets {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		_ = socket.write(ctx, []bayeuxMessage{msgs[i]})
+		cancel()
+	}
+	return delivered
+}
+
+/*//////// Scripting ////////*/
+
+// Push sends raw data to every push client subscribed to the channel and returns how many there were
+func (s *Server) Push(channel string, data map[string]any) int {
+	return s.push.deliver(channel, data)
+}
+
+// PushEvent sends an event the way GroupMe does, e.g. PushEvent("/user/1", "line.create", message)
+func (s *Server) PushEvent(channel, eventType string, subject any) int {
+	// Round trip the subject so the data looks exactly like it would after decoding it from the wire
+	b, _ := json.Marshal(subject)
+	var decoded any
+	_ = json.Unmarshal(b, &decoded)
+	return s.Push(channel, map[string]any{
+		"type":    eventType,
+		"subject": decoded,
+		"alert":   "",
+	})
+}
+
+// PushMessage sends a message to the user channel of the logged in user, as a group or direct message
+func (s *Server) PushMessage(message *groupmeclient.Message) int {
+	s.lock.Lock()
+	channel := "/user/" + s.me.ID.String()
+	s.lock.Unlock()
+	eventType := "line.create"
+	if message.GroupID == "" {
+		eventType = "direct_message.create"
+	}
+	return s.PushEvent(channel, eventType, message)
+}
+
+// WaitForSubscription blocks until a push client subscribed to the channel
+func (s *Server) WaitForSubscription(ctx context.Context, channel string) error {
+	for {
+		s.push.lock.Lock()
+		subscribed := s.push.subscribed
+		for _, client := range s.push.clients {
+			if client.subscriptions[channel] {
+				s.push.lock.Unlock()
+				return nil
+			}
+		}
+		s.push.lock.Unlock()
+
+		select {
+		case <-subscribed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Subscribed returns whether any push client is subscribed to the channel
+func (s *Server) Subscribed(channel string) bool {
+	s.push.lock.Lock()
+	defer s.push.lock.Unlock()
+	for _, client := range s.push.clients {
+		if client.subscriptions[channel] {
+			return true
+		}
+	}
+	return false
+}
+
+// SetPushConnectionTypes changes the transports the push server offers in handshakes,
+// without "websocket" the endpoint also refuses websocket upgrades
+func (s *Server) SetPushConnectionTypes(connectionTypes ...string) {
+	s.push.lock.Lock()
+	defer s.push.lock.Unlock()
+	s.push.connectionTypes = connectionTypes
+}
+
+// BlockPushWebsockets makes the push endpoint refuse websocket upgrades while handshakes still offer
+// them, the way a proxy that doesn't support websockets breaks them
+func (s *Server) BlockPushWebsockets(blocked bool) {
+	s.push.lock.Lock()
+	defer s.push.lock.Unlock()
+	s.push.websocketsBlocked = blocked
+}
+
+// DropPushConnections closes every push websocket without a goodbye, like a network failure would
+func (s *Server) DropPushConnections() {
+	s.push.lock.Lock()
+	defer s.push.lock.Unlock()
+	for socket := range s.push.sockets {
+		_ = socket.conn.CloseNow()
+	}
+}
@@ -0,0 +1,546 @@
+package groupmetest
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GroveJay/matrix-groupme-bridge/pkg/groupmeclient"
+)
+
+// Page sizes GroupMe uses when the request doesn't specify one
+const (
+	defaultGroupsPerPage   = 10
+	defaultChatsPerPage    = 20
+	defaultMessagesLimit   = 20
+	maxMessagesLimit       = 100
+	relationsPerPage       = 200
+	shareURLBase           = "https://groupme.com/join_group/"
+	fakeImageServiceDomain = "https://i.groupme.com/"
+)
+
+func (s *Server) registerREST(mux *http.ServeMux) {
+	handle := func(pattern string, handler http.HandlerFunc) {
+		mux.Handle(pattern, s.authorize(handler))
+	}
+	handle("GET /v3/users/me", s.getMe)
+	handle("POST /v3/users/update", s.updateMe)
+	handle("GET /v3/groups", s.indexGroups)
+	handle("GET /v3/groups/former", s.indexFormerGroups)
+	handle("POST /v3/groups", s.createGroup)
+	handle("GET /v3/groups/{group}", s.showGroup)
+	handle("POST /v3/groups/{group}/update", s.updateGroup)
+	handle("POST /v3/groups/{group}/destroy", s.destroyGroup)
+	handle("GET /v3/groups/{group}/messages", s.indexMessages)
+	handle("POST /v3/groups/{group}/messages", s.createMessage)
+	handle("GET /v3/direct_messages", s.indexDirectMessages)
+	handle("POST /v3/direct_messages", s.createDirectMessage)
+	handle("GET /v3/chats", s.indexChats)
+	handle("GET /v4/relationships", s.indexRelations)
+	handle("GET /v3/bots", s.indexBots)
+	handle("POST /v3/bots", s.createBot)
+	handle("POST /v3/bots/destroy", s.destroyBot)
+	// Bots post with their ID instead of an access token
+	mux.HandleFunc("POST /v3/bots/post", s.postBotMessage)
+	handle("POST /image/pictures", s.uploadImage)
+}
+
+// authorize rejects requests without the token of the fake, like GroupMe does with revoked tokens
+func (s *Server) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get("token")
+		if token == "" {
+			token = r.Header.Get("X-Access-Token")
+		}
+		if token != s.Token {
+			writeError(w, groupmeclient.HTTPUnauthorized, "unauthorized")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeConditional answers listings with an ETag, and with 304 if the client already has the same listing
+func writeConditional(w http.ResponseWriter, r *http.Request, response any) {
+	body, _ := json.Marshal(map[string]any{
+		"response": response,
+		"meta":     groupmeclient.Meta{Code: groupmeclient.HTTPOk},
+	})
+	etag := fmt.Sprintf(`"%x"`, sha256.Sum256(body))
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(int(groupmeclient.HTTPNotModified))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(int(groupmeclient.HTTPOk))
+	_, _ = w.Write(body)
+}
+
+func decodeBody(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, groupmeclient.HTTPBadRequest, err.Error())
+		return false
+	}
+	return true
+}
+
+func queryInt(r *http.Request, key string, fallback int) int {
+	if value, err := strconv.Atoi(r.URL.Query().Get(key)); err == nil && value > 0 {
+		return value
+	}
+	return fallback
+}
+
+// paginate returns the page of items requested through the page and per_page parameters
+func paginate[T any](r *http.Request, items []T, defaultPerPage int) []T {
+	page := queryInt(r, "page", 1)
+	perPage := queryInt(r, "per_page", defaultPerPage)
+	start := min((page-1)*perPage, len(items))
+	end := min(start+perPage, len(items))
+	return items[start:end]
+}
+
+/*//////// Users ////////*/
+
+func (s *Server) getMe(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	writeResponse(w, groupmeclient.HTTPOk, s.me)
+}
+
+func (s *Server) updateMe(w http.ResponseWriter, r *http.Request) {
+	var settings groupmeclient.UserSettings
+	if !decodeBody(w, r, &settings) {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if settings.Name != "" {
+		s.me.Name = settings.Name
+	}
+	if settings.AvatarURL != "" {
+		s.me.ImageURL = settings.AvatarURL
+	}
+	if settings.Email != "" {
+		s.me.Email = settings.Email
+	}
+	writeResponse(w, groupmeclient.HTTPOk, s.me)
+}
+
+func (s *Server) indexRelations(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var since time.Time
+	if value := r.URL.Query().Get("since"); value != "" {
+		since, _ = time.Parse(time.RFC3339, value)
+	}
+	var users []*groupmeclient.User
+	for _, user := range s.users {
+		if user.UpdatedAt.ToTime().After(since) {
+			users = append(users, user)
+		}
+	}
+	slices.SortFunc(users, func(a, b *groupmeclient.User) int {
+		return cmp.Or(cmp.Compare(a.UpdatedAt, b.UpdatedAt), cmp.Compare(a.ID, b.ID))
+	})
+	writeResponse(w, groupmeclient.HTTPOk, users[:min(len(users), relationsPerPage)])
+}
+
+/*//////// Groups ////////*/
+
+// sortedGroups orders groups by most recently updated, like GroupMe does
+func sortedGroups(groups map[groupmeclient.ID]*groupmeclient.Group) []*groupmeclient.Group {
+	sorted := make([]*groupmeclient.Group, 0, len(groups))
+	for _, group := range groups {
+		sorted = append(sorted, group)
+	}
+	slices.SortFunc(sorted, func(a, b *groupmeclient.Group) int {
+		return cmp.Or(cmp.Compare(b.UpdatedAt, a.UpdatedAt), cmp.Compare(a.ID, b.ID))
+	})
+	return sorted
+}
+
+func (s *Server) indexGroups(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	groups := paginate(r, sortedGroups(s.groups), defaultGroupsPerPage)
+	if r.URL.Query().Get("omit") == "memberships" {
+		withoutMembers := make([]*groupmeclient.Group, len(groups))
+		for i, group := range groups {
+			copied := *group
+			copied.Members = nil
+			withoutMembers[i] = &copied
+		}
+		groups = withoutMembers
+	}
+	writeConditional(w, r, groups)
+}
+
+func (s *Server) indexFormerGroups(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	writeConditional(w, r, sortedGroups(s.formerGroups))
+}
+
+func (s *Server) showGroup(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	group, ok := s.groups[groupmeclient.ID(r.PathValue("group"))]
+	if !ok {
+		writeError(w, groupmeclient.HTTPNotFound, "group not found")
+		return
+	}
+	writeResponse(w, groupmeclient.HTTPOk, group)
+}
+
+func (s *Server) createGroup(w http.ResponseWriter, r *http.Request) {
+	var settings groupmeclient.GroupSettings
+	if !decodeBody(w, r, &settings) {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	now := groupmeclient.FromTime(time.Now())
+	group := &groupmeclient.Group{
+		ID:            s.newID(),
+		Type:          "private",
+		CreatorUserID: s.me.ID,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+		Members: []*groupmeclient.Member{{
+			ID:       s.newID(),
+			UserID:   s.me.ID,
+			Nickname: s.me.Name,
+			Roles:    []groupmeclient.MemberRole{groupmeclient.MemberRoleOwner, groupmeclient.MemberRoleAdmin},
+		}},
+	}
+	s.applyGroupSettings(group, settings)
+	s.groups[group.ID] = group
+	writeResponse(w, groupmeclient.HTTPCreated, group)
+}
+
+func (s *Server) applyGroupSettings(group *groupmeclient.Group, settings groupmeclient.GroupSettings) {
+	group.Name = settings.Name
+	group.Description = settings.Description
+	group.ImageURL = settings.ImageURL
+	group.OfficeMode = settings.OfficeMode
+	if !settings.Share {
+		group.ShareURL = ""
+	} else if group.ShareURL == "" {
+		group.ShareURL = shareURLBase + group.ID.String() + "/" + s.newID().String()
+	}
+	group.UpdatedAt = groupmeclient.FromTime(time.Now())
+}
+
+func (s *Server) updateGroup(w http.ResponseWriter, r *http.Request) {
+	var settings groupmeclient.GroupSettings
+	if !decodeBody(w, r, &settings) {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	group, ok := s.groups[groupmeclient.ID(r.PathValue("group"))]
+	if !ok {
+		writeError(w, groupmeclient.HTTPNotFound, "group not found")
+		return
+	}
+	s.applyGroupSettings(group, settings)
+	writeResponse(w, groupmeclient.HTTPOk, group)
+}
+
+func (s *Server) destroyGroup(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	groupID := groupmeclient.ID(r.PathValue("group"))
+	group, ok := s.groups[groupID]
+	if !ok {
+		writeError(w, groupmeclient.HTTPNotFound, "group not found")
+		return
+	} else if group.CreatorUserID != s.me.ID {
+		writeError(w, groupmeclient.HTTPForbidden, "only the creator can destroy the group")
+		return
+	}
+	delete(s.groups, groupID)
+	writeResponse(w, groupmeclient.HTTPOk, nil)
+}
+
+/*//////// Messages ////////*/
+
+// pageMessages applies the before_id, since_id, after_id and limit parameters to a history
+// that is ordered oldest first
+func pageMessages(r *http.Request, history []*groupmeclient.Message) []*groupmeclient.Message {
+	query := r.URL.Query()
+	limit := min(queryInt(r, "limit", defaultMessagesLimit), maxMessagesLimit)
+	indexOf := func(id string) int {
+		return slices.IndexFunc(history, func(m *groupmeclient.Message) bool { return m.ID.String() == id })
+	}
+
+	var page []*groupmeclient.Message
+	// The client sends before_ID for direct messages
+	if before := cmp.Or(query.Get("before_id"), query.Get("before_ID")); before != "" {
+		index := max(indexOf(before), 0)
+		page = slices.Clone(history[max(index-limit, 0):index])
+	} else if after := query.Get("after_id"); after != "" {
+		index := indexOf(after) + 1
+		// after_id is the only parameter that returns messages in ascending order
+		return slices.Clone(history[index:min(index+limit, len(history))])
+	} else if since := query.Get("since_id"); since != "" {
+		index := indexOf(since) + 1
+		page = slices.Clone(history[max(index, len(history)-limit):])
+	} else {
+		page = slices.Clone(history[max(len(history)-limit, 0):])
+	}
+	slices.Reverse(page)
+	return page
+}
+
+func (s *Server) indexMessages(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	groupID := groupmeclient.ID(r.PathValue("group"))
+	if _, ok := s.groups[groupID]; !ok {
+		writeError(w, groupmeclient.HTTPNotFound, "group not found")
+		return
+	}
+	messages := pageMessages(r, s.messages[groupID])
+	if len(messages) == 0 {
+		w.WriteHeader(int(groupmeclient.HTTPNotModified))
+		return
+	}
+	writeResponse(w, groupmeclient.HTTPOk, groupmeclient.IndexMessagesResponse{
+		Count:    len(s.messages[groupID]),
+		Messages: messages,
+	})
+}
+
+// sentMessage fills in what GroupMe sets on messages the logged in user sends
+func (s *Server) sentMessage(message *groupmeclient.Message) {
+	message.ID = s.newID()
+	message.CreatedAt = groupmeclient.FromTime(time.Now())
+	message.UserID = s.me.ID
+	message.SenderID = s.me.ID
+	message.SenderType = groupmeclient.SenderTypeUser
+	message.Name = s.me.Name
+	message.AvatarURL = s.me.ImageURL
+}
+
+// findSourceGUID returns the message that was already sent with the GUID, GroupMe doesn't send those twice
+func findSourceGUID(history []*groupmeclient.Message, sourceGUID string) *groupmeclient.Message {
+	if sourceGUID == "" {
+		return nil
+	}
+	index := slices.IndexFunc(history, func(m *groupmeclient.Message) bool { return m.SourceGUID == sourceGUID })
+	if index < 0 {
+		return nil
+	}
+	return history[index]
+}
+
+func (s *Server) createMessage(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Message *groupmeclient.Message `json:"message"`
+	}
+	if !decodeBody(w, r, &req) || req.Message == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	groupID := groupmeclient.ID(r.PathValue("group"))
+	group, ok := s.groups[groupID]
+	if !ok {
+		writeError(w, groupmeclient.HTTPNotFound, "group not found")
+		return
+	}
+	message := findSourceGUID(s.messages[groupID], req.Message.SourceGUID)
+	if message == nil {
+		message = req.Message
+		s.sentMessage(message)
+		message.GroupID = groupID
+		s.messages[groupID] = append(s.messages[groupID], message)
+		group.UpdatedAt = message.CreatedAt
+	}
+	writeResponse(w, groupmeclient.HTTPCreated, map[string]any{"message": message})
+}
+
+func (s *Server) indexDirectMessages(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	otherUser := groupmeclient.ID(r.URL.Query().Get("other_user_id"))
+	if otherUser == "" {
+		writeError(w, groupmeclient.HTTPBadRequest, "other_user_id is required")
+		return
+	}
+	history := s.directMessages[ChatID(s.me.ID, otherUser)]
+	messages := pageMessages(r, history)
+	if len(messages) == 0 {
+		w.WriteHeader(int(groupmeclient.HTTPNotModified))
+		return
+	}
+	writeResponse(w, groupmeclient.HTTPOk, groupmeclient.IndexDirectMessagesResponse{
+		Count:    len(history),
+		Messages: messages,
+	})
+}
+
+func (s *Server) createDirectMessage(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		DirectMessage *groupmeclient.Message `json:"direct_message"`
+	}
+	if !decodeBody(w, r, &req) || req.DirectMessage == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if req.DirectMessage.RecipientID == "" {
+		writeError(w, groupmeclient.HTTPBadRequest, "recipient_id is required")
+		return
+	}
+	history := s.directMessages[ChatID(s.me.ID, req.DirectMessage.RecipientID)]
+	message := findSourceGUID(history, req.DirectMessage.SourceGUID)
+	if message == nil {
+		message = req.DirectMessage
+		s.sentMessage(message)
+		s.addDirectMessage(message)
+	}
+	writeResponse(w, groupmeclient.HTTPCreated, map[string]any{"direct_message": message})
+}
+
+func (s *Server) indexChats(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var chats []*groupmeclient.Chat
+	for chatID, history := range s.directMessages {
+		if len(history) == 0 {
+			continue
+		}
+		otherUser := s.me.ID
+		for _, id := range strings.Split(chatID.String(), "+") {
+			if id != s.me.ID.String() {
+				otherUser = groupmeclient.ID(id)
+			}
+		}
+		user, ok := s.users[otherUser]
+		if !ok {
+			user = &groupmeclient.User{ID: otherUser}
+		}
+		last := history[len(history)-1]
+		chats = append(chats, &groupmeclient.Chat{
+			CreatedAt:     history[0].CreatedAt,
+			UpdatedAt:     last.CreatedAt,
+			LastMessage:   last,
+			MessagesCount: len(history),
+			OtherUser:     *user,
+		})
+	}
+	slices.SortFunc(chats, func(a, b *groupmeclient.Chat) int {
+		return cmp.Or(cmp.Compare(b.UpdatedAt, a.UpdatedAt), cmp.Compare(a.OtherUser.ID, b.OtherUser.ID))
+	})
+	writeConditional(w, r, paginate(r, chats, defaultChatsPerPage))
+}
+
+/*//////// Bots ////////*/
+
+func (s *Server) indexBots(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	bots := make([]*groupmeclient.Bot, 0, len(s.bots))
+	for _, bot := range s.bots {
+		bots = append(bots, bot)
+	}
+	slices.SortFunc(bots, func(a, b *groupmeclient.Bot) int {
+		return cmp.Compare(a.BotID, b.BotID)
+	})
+	writeResponse(w, groupmeclient.HTTPOk, bots)
+}
+
+func (s *Server) createBot(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Bot *groupmeclient.Bot `json:"bot"`
+	}
+	if !decodeBody(w, r, &req) || req.Bot == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if req.Bot.Name == "" {
+		writeError(w, groupmeclient.HTTPBadRequest, "name is required")
+		return
+	} else if _, ok := s.groups[req.Bot.GroupID]; !ok {
+		writeError(w, groupmeclient.HTTPNotFound, "group not found")
+		return
+	}
+	bot := *req.Bot
+	bot.BotID = s.newID()
+	s.bots[bot.BotID] = &bot
+	writeResponse(w, groupmeclient.HTTPCreated, map[string]any{"bot": &bot})
+}
+
+func (s *Server) postBotMessage(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		BotID      groupmeclient.ID `json:"bot_id"`
+		Text       string           `json:"text"`
+		PictureURL string           `json:"picture_url"`
+	}
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	bot, ok := s.bots[req.BotID]
+	if !ok {
+		writeError(w, groupmeclient.HTTPNotFound, "bot not found")
+		return
+	}
+	message := &groupmeclient.Message{
+		ID:         s.newID(),
+		GroupID:    bot.GroupID,
+		CreatedAt:  groupmeclient.FromTime(time.Now()),
+		SenderID:   bot.BotID,
+		SenderType: groupmeclient.SenderTypeBot,
+		Name:       bot.Name,
+		AvatarURL:  bot.AvatarURL,
+		Text:       req.Text,
+	}
+	if req.PictureURL != "" {
+		message.Attachments = []*groupmeclient.Attachment{{Type: groupmeclient.Image, URL: req.PictureURL}}
+	}
+	s.messages[bot.GroupID] = append(s.messages[bot.GroupID], message)
+	// GroupMe accepts bot posts without a body
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (s *Server) destroyBot(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		BotID groupmeclient.ID `json:"bot_id"`
+	}
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.bots[req.BotID]; !ok {
+		writeError(w, groupmeclient.HTTPNotFound, "bot not found")
+		return
+	}
+	delete(s.bots, req.BotID)
+	writeResponse(w, groupmeclient.HTTPOk, nil)
+}
+
+/*//////// Images ////////*/
+
+func (s *Server) uploadImage(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	url := fakeImageServiceDomain + s.newID().String()
+	s.lock.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"payload": groupmeclient.ImageServiceResponse{URL: url, PictureURL: url},
+	})
+}
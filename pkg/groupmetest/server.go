@@ -0,0 +1,282 @@
+// Package groupmetest runs an in-process fake of the GroupMe API and push server for tests
+package groupmetest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+
+	"github.com/GroveJay/matrix-groupme-bridge/pkg/groupmeclient"
+)
+
+// Request is a request the fake received, recorded for assertions
+type Request struct {
+	Method string
+	Path   string
+	Query  url.Values
+	Header http.Header
+	Body   []byte
+}
+
+// Decode unmarshals the JSON body of the request
+func (r Request) Decode(v any) error {
+	return json.Unmarshal(r.Body, v)
+}
+
+// failure is a scripted error response
+type failure struct {
+	method string
+	path   string
+	code   groupmeclient.HTTPStatusCode
+	times  int
+}
+
+// Server is a fake GroupMe. Its state is seeded through the Add* methods, and everything a
+// client does goes through the same handlers the real API has, so tests can assert on both
+// the recorded requests and the resulting state.
+type Server struct {
+	// URL of the fake, see ClientOptions and PushServer for the URLs clients should use
+	URL string
+	// Token is the only access token the fake accepts
+	Token string
+
+	server *httptest.Server
+	push   *pushServer
+
+	lock           sync.Mutex
+	me             *groupmeclient.User
+	users          map[groupmeclient.ID]*groupmeclient.User
+	groups         map[groupmeclient.ID]*groupmeclient.Group
+	formerGroups   map[groupmeclient.ID]*groupmeclient.Group
+	messages       map[groupmeclient.ID][]*groupmeclient.Message
+	directMessages map[groupmeclient.ID][]*groupmeclient.Message
+	bots           map[groupmeclient.ID]*groupmeclient.Bot
+	requests       []Request
+	failures       []*failure
+	nextID         int
+}
+
+// NewServer starts a fake GroupMe where token belongs to me. Close it when the test is done.
+func NewServer(token string, me *groupmeclient.User) *Server {
+	s := &Server{
+		Token:          token,
+		me:             me,
+		users:          make(map[groupmeclient.ID]*groupmeclient.User),
+		groups:         make(map[groupmeclient.ID]*groupmeclient.Group),
+		formerGroups:   make(map[groupmeclient.ID]*groupmeclient.Group),
+		messages:       make(map[groupmeclient.ID][]*groupmeclient.Message),
+		directMessages: make(map[groupmeclient.ID][]*groupmeclient.Message),
+		bots:           make(map[groupmeclient.ID]*groupmeclient.Bot),
+		nextID:         1000,
+	}
+	s.push = newPushServer(s)
+
+	mux := http.NewServeMux()
+	s.registerREST(mux)
+	mux.HandleFunc("/faye", s.push.handle)
+	s.server = httptest.NewServer(s.record(mux))
+	s.URL = s.server.URL
+	return s
+}
+
+// Close disconnects all push clients and shuts the fake down
+func (s *Server) Close() {
+	s.push.close()
+	s.server.Close()
+}
+
+// ClientOptions point a groupmeclient.Client at the fake
+func (s *Server) ClientOptions() []groupmeclient.ClientOption {
+	return []groupmeclient.ClientOption{
+		groupmeclient.WithAPIBase(s.URL + "/v3"),
+		groupmeclient.WithAPIBaseV4(s.URL + "/v4"),
+		groupmeclient.WithImageServiceBase(s.URL + "/image"),
+	}
+}
+
+// NewClient creates a client for the fake that uses its token
+func (s *Server) NewClient(options ...groupmeclient.ClientOption) *groupmeclient.Client {
+	return groupmeclient.NewClient(s.Token, append(s.ClientOptions(), options...)...)
+}
+
+// PushServer is the URL of the faye endpoint, for groupmerealtime.NewFayeClientForServer
+func (s *Server) PushServer() string {
+	return s.URL + "/faye"
+}
+
+/*//////// State ////////*/
+
+func (s *Server) newID() groupmeclient.ID {
+	s.nextID++
+	return groupmeclient.ID(strconv.Itoa(s.nextID))
+}
+
+// AddUser adds a user that shows up in the relations of the logged in user
+func (s *Server) AddUser(user *groupmeclient.User) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.users[user.ID] = user
+}
+
+// AddGroup adds a group the logged in user is a member of
+func (s *Server) AddGroup(group *groupmeclient.Group) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.groups[group.ID] = group
+}
+
+// AddFormerGroup adds a group the logged in user left
+func (s *Server) AddFormerGroup(group *groupmeclient.Group) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.formerGroups[group.ID] = group
+}
+
+// Group returns the current state of a group, or nil if it doesn't exist
+func (s *Server) Group(groupID groupmeclient.ID) *groupmeclient.Group {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.groups[groupID]
+}
+
+// AddMessage adds a message to the history of a group, messages must be added oldest first
+func (s *Server) AddMessage(groupID groupmeclient.ID, message *groupmeclient.Message) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	message.GroupID = groupID
+	s.messages[groupID] = append(s.messages[groupID], message)
+}
+
+// Messages returns the history of a group, oldest first
+func (s *Server) Messages(groupID groupmeclient.ID) []*groupmeclient.Message {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]*groupmeclient.Message(nil), s.messages[groupID]...)
+}
+
+// AddDirectMessage adds a message to the history of a DM between the logged in user and
+// the message's sender or recipient, messages must be added oldest first
+func (s *Server) AddDirectMessage(message *groupmeclient.Message) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.addDirectMessage(message)
+}
+
+func (s *Server) addDirectMessage(message *groupmeclient.Message) {
+	otherUser := message.RecipientID
+	if otherUser == s.me.ID {
+		otherUser = message.SenderID
+	}
+	chatID := ChatID(s.me.ID, otherUser)
+	message.ChatID = chatID
+	message.ConversationID = chatID
+	s.directMessages[chatID] = append(s.directMessages[chatID], message)
+}
+
+// DirectMessages returns the history of the DM with another user, oldest first
+func (s *Server) DirectMessages(otherUser groupmeclient.ID) []*groupmeclient.Message {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]*groupmeclient.Message(nil), s.directMessages[ChatID(s.me.ID, otherUser)]...)
+}
+
+// ChatID is the ID GroupMe uses for the DM between two users
+func ChatID(a, b groupmeclient.ID) groupmeclient.ID {
+	if b < a {
+		a, b = b, a
+	}
+	return a + "+" + b
+}
+
+/*//////// Requests ////////*/
+
+// Requests returns every request the fake received so far, in order
+func (s *Server) Requests() []Request {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// RequestsTo returns the requests received for a method and path, e.g. ("POST", "/v3/groups/1/messages")
+func (s *Server) RequestsTo(method, path string) []Request {
+	var matching []Request
+	for _, req := range s.Requests() {
+		if req.Method == method && req.Path == path {
+			matching = append(matching, req)
+		}
+	}
+	return matching
+}
+
+// Fail makes the next requests to a method and path fail with the status code, times is the number
+// of requests that fail before the fake handles them normally again
+func (s *Server) Fail(method, path string, code groupmeclient.HTTPStatusCode, times int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.failures = append(s.failures, &failure{method: method, path: path, code: code, times: times})
+}
+
+// scriptedFailure returns the status code of a matching scripted failure, or 0
+func (s *Server) scriptedFailure(r *http.Request) groupmeclient.HTTPStatusCode {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, f := range s.failures {
+		if f.times > 0 && f.method == r.Method && f.path == r.URL.Path {
+			f.times--
+			return f.code
+		}
+	}
+	return 0
+}
+
+// record keeps every request (except the push server's, which aren't part of the API) and applies scripted failures
+func (s *Server) record(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/faye" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		s.lock.Lock()
+		s.requests = append(s.requests, Request{
+			Method: r.Method,
+			Path:   r.URL.Path,
+			Query:  r.URL.Query(),
+			Header: r.Header.Clone(),
+			Body:   body,
+		})
+		s.lock.Unlock()
+
+		if code := s.scriptedFailure(r); code != 0 {
+			writeError(w, code, fmt.Sprintf("scripted %d", code))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeResponse wraps the response the way the GroupMe API does
+func writeResponse(w http.ResponseWriter, code groupmeclient.HTTPStatusCode, response any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(int(code))
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"response": response,
+		"meta":     groupmeclient.Meta{Code: code},
+	})
+}
+
+func writeError(w http.ResponseWriter, code groupmeclient.HTTPStatusCode, errs ...string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(int(code))
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"response": nil,
+		"meta":     groupmeclient.Meta{Code: code, Errors: errs},
+	})
+}
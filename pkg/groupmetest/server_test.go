@@ -0,0 +1,164 @@
+package groupmetest_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/GroveJay/matrix-groupme-bridge/pkg/groupmeclient"
+	"github.com/GroveJay/matrix-groupme-bridge/pkg/groupmerealtime"
+	"github.com/GroveJay/matrix-groupme-bridge/pkg/groupmetest"
+	"github.com/rs/zerolog"
+)
+
+const testToken = "token"
+
+func newTestServer(t *testing.T) *groupmetest.Server {
+	t.Helper()
+	server := groupmetest.NewServer(testToken, &groupmeclient.User{ID: "1", Name: "Me"})
+	t.Cleanup(server.Close)
+	server.AddUser(&groupmeclient.User{ID: "2", Name: "Friend", UpdatedAt: 1})
+	server.AddGroup(&groupmeclient.Group{
+		ID:            "10",
+		Name:          "Group",
+		CreatorUserID: "1",
+		Members: []*groupmeclient.Member{
+			{ID: "100", UserID: "1", Nickname: "Me"},
+			{ID: "101", UserID: "2", Nickname: "Friend"},
+		},
+	})
+	return server
+}
+
+func TestREST(t *testing.T) {
+	server := newTestServer(t)
+	client := server.NewClient()
+	ctx := context.Background()
+
+	me, err := client.MyUser(ctx)
+	if err != nil {
+		t.Fatal(err)
+	} else if me.ID != "1" {
+		t.Errorf("MyUser().ID = %q, want %q", me.ID, "1")
+	}
+
+	groups, err := client.IndexGroups(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(groups) != 1 || groups[0].ID != "10" {
+		t.Errorf("IndexGroups() = %v, want group 10", groups)
+	}
+
+	relations, err := client.IndexAllRelations(ctx)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(relations) != 1 || relations[0].ID != "2" {
+		t.Errorf("IndexAllRelations() = %v, want user 2", relations)
+	}
+
+	sent, err := client.CreateMessage(ctx, "10", &groupmeclient.Message{Text: "hello"})
+	if err != nil {
+		t.Fatal(err)
+	} else if sent.ID == "" || sent.SenderID != "1" {
+		t.Errorf("CreateMessage() = %v, want a message sent by user 1", sent)
+	}
+	requests := server.RequestsTo("POST", "/v3/groups/10/messages")
+	if len(requests) != 1 {
+		t.Fatalf("got %d requests to send a message, want 1", len(requests))
+	}
+	var body struct {
+		Message groupmeclient.Message `json:"message"`
+	}
+	if err := requests[0].Decode(&body); err != nil {
+		t.Fatal(err)
+	} else if body.Message.Text != "hello" || body.Message.SourceGUID == "" {
+		t.Errorf("sent message = %v, want text and a source GUID", body.Message)
+	}
+
+	// No newer messages is a 304, which the client returns as an empty result
+	messages, err := client.IndexMessages(ctx, "10", &groupmeclient.IndexMessagesQuery{SinceID: sent.ID})
+	if err != nil {
+		t.Fatal(err)
+	} else if len(messages.Messages) != 0 {
+		t.Errorf("IndexMessages() returned %d messages, want none", len(messages.Messages))
+	}
+
+	if _, err := client.CreateDirectMessage(ctx, &groupmeclient.Message{RecipientID: "2", Text: "hi"}); err != nil {
+		t.Fatal(err)
+	}
+	chats, err := client.IndexChats(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(chats) != 1 || chats[0].OtherUser.ID != "2" || chats[0].LastMessage.Text != "hi" {
+		t.Errorf("IndexChats() = %v, want the chat with user 2", chats)
+	}
+}
+
+func TestRESTErrors(t *testing.T) {
+	server := newTestServer(t)
+	ctx := context.Background()
+
+	_, err := groupmeclient.NewClient("wrong", server.ClientOptions()...).MyUser(ctx)
+	if !errors.Is(err, groupmeclient.ErrUnauthorized) {
+		t.Errorf("MyUser() with the wrong token = %v, want ErrUnauthorized", err)
+	}
+
+	client := server.NewClient()
+	_, err = client.ShowGroup(ctx, "404")
+	if !errors.Is(err, groupmeclient.ErrNotFound) {
+		t.Errorf("ShowGroup() of a missing group = %v, want ErrNotFound", err)
+	}
+
+	server.Fail("GET", "/v3/groups/10", groupmeclient.HTTPForbidden, 1)
+	if _, err = client.ShowGroup(ctx, "10"); !errors.Is(err, groupmeclient.ErrForbidden) {
+		t.Errorf("ShowGroup() with a scripted failure = %v, want ErrForbidden", err)
+	}
+	if _, err = client.ShowGroup(ctx, "10"); err != nil {
+		t.Errorf("ShowGroup() after the scripted failure = %v, want success", err)
+	}
+}
+
+type textHandler struct {
+	messages chan groupmeclient.Message
+}
+
+func (h *textHandler) HandleError(err error) {}
+
+func (h *textHandler) HandleTextMessage(message groupmeclient.Message) {
+	h.messages <- message
+}
+
+func TestPush(t *testing.T) {
+	server := newTestServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	handler := &textHandler{messages: make(chan groupmeclient.Message, 1)}
+	subscription := groupmerealtime.NewPushSubscription(ctx)
+	subscription.AddHandler(handler)
+	defer subscription.Stop()
+	logger := groupmerealtime.FayeZeroLogger{Logger: zerolog.Nop()}
+	fayeClient := groupmerealtime.NewFayeClientForServer(logger, server.PushServer(), testToken)
+	if err := subscription.Setup(ctx, fayeClient); err != nil {
+		t.Fatal(err)
+	}
+	if err := subscription.SubscribeToUser(ctx, "1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.WaitForSubscription(ctx, "/user/1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if delivered := server.PushMessage(&groupmeclient.Message{ID: "5", GroupID: "10", SenderID: "2", Text: "pushed"}); delivered != 1 {
+		t.Fatalf("PushMessage() delivered to %d clients, want 1", delivered)
+	}
+	select {
+	case message := <-handler.messages:
+		if message.ID != "5" || message.Text != "pushed" {
+			t.Errorf("got message %v, want the pushed message", message)
+		}
+	case <-ctx.Done():
+		t.Fatal("pushed message was never handled")
+	}
+}
@@ -45,7 +45,7 @@ func connectToPushAndSleepIndefinitely(ctx context.Context, logger *zerolog.Logg
 	}
 	pushSubscription.AddFullHandler(&fullHandler)
 	fayeLogger := &groupmerealtime.FayeZeroLogger{Logger: *logger}
-	err := pushSubscription.Setup(context.Background(), *groupmerealtime.NewFayeClient(*fayeLogger, AuthToken))
+	err := pushSubscription.Setup(context.Background(), groupmerealtime.NewFayeClient(*fayeLogger, AuthToken))
 	if err != nil {
 		logger.Error().Msgf("Got error from setup: %s", err)
 		return
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"time"
+
+	"github.com/GroveJay/matrix-groupme-bridge/pkg/faye"
 	"github.com/GroveJay/matrix-groupme-bridge/pkg/groupmeclient"
 	"github.com/GroveJay/matrix-groupme-bridge/pkg/groupmerealtime"
 	"github.com/rs/zerolog"
@@ -50,6 +53,16 @@ func (g *gha) HandleMembers(group groupmeclient.ID, members []groupmeclient.Memb
 	g.logger.Debug().Msgf("HandleMembers (groupID: %s, members(len): %d, added: %t)", group, len(members), added)
 }
 
+// HandleMemberRoles implements groupmeclient.HandlerAll.
+func (g *gha) HandleMemberRoles(group groupmeclient.ID, user groupmeclient.ID, roles []groupmeclient.MemberRole) {
+	g.logger.Debug().Msgf("HandleMemberRoles (groupID: %s, userID: %s, roles: %v)", group, user, roles)
+}
+
+// HandleMemberRemoved implements groupmeclient.HandlerAll.
+func (g *gha) HandleMemberRemoved(group groupmeclient.ID, removed groupmeclient.Member, remover *groupmeclient.Member) {
+	g.logger.Debug().Msgf("HandleMemberRemoved (groupID: %s, removed: %s, kicked: %t)", group, removed.UserID, remover != nil)
+}
+
 // HandleNewAvatarInGroup implements groupmeclient.HandlerAll.
 func (g *gha) HandleNewAvatarInGroup(group groupmeclient.ID, user groupmeclient.ID, avatarURL string) {
 	g.logger.Debug().Msgf("HandleNewAvatarInGroup (groupID: %s, userID: %s, newName: %s)", group, user, avatarURL)
@@ -60,6 +73,21 @@ func (g *gha) HandleNewNickname(group groupmeclient.ID, user groupmeclient.ID, n
 	g.logger.Debug().Msgf("HandleNewNickname (groupID: %s, userID: %s, newName: %s)", group, user, newName)
 }
 
+// HandleConnectionEvent implements groupmeclient.HandlerAll.
+func (g *gha) HandleConnectionEvent(event faye.ConnectionEvent, err error) {
+	g.logger.Debug().Msgf("HandleConnectionEvent (event: %s, error: %v)", event, err)
+}
+
+// HandleReconnectAttempt implements groupmeclient.HandlerAll.
+func (g *gha) HandleReconnectAttempt(retry int, delay time.Duration, err error) {
+	g.logger.Debug().Msgf("HandleReconnectAttempt (retry: %d, delay: %s, error: %v)", retry, delay, err)
+}
+
+// HandleReadReceipt implements groupmeclient.HandlerAll.
+func (g *gha) HandleReadReceipt(receipt groupmeclient.ReadReceipt) {
+	g.logger.Debug().Msgf("HandleReadReceipt (chatID: %s, messageID: %s, userID: %s)", receipt.ChatID, receipt.MessageID, receipt.UserID)
+}
+
 // HandleTextMessage implements groupmeclient.HandlerAll.
 func (g *gha) HandleTextMessage(groupmeclient.Message) {
 	g.logger.Debug().Msg("HandleTextMessage")